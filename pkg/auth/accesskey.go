@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	"github.com/arrow2012/nuwa-kit/pkg/crypto"
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+)
+
+const (
+	accessKeyCachePrefix = "auth:ak:"
+	accessKeyNotFound    = "-"
+	accessKeyNegativeTTL = time.Minute
+
+	// DefaultAccessKeyCacheTTL is used by NewCachedAccessKeyStore for a ttl <= 0
+	DefaultAccessKeyCacheTTL = 5 * time.Minute
+)
+
+var (
+	ErrAccessKeyNotFound = errors.New("access key not found")
+	ErrAccessKeyDisabled = errors.New("access key disabled")
+)
+
+// AccessKey is an access key pair and the identity it acts as
+type AccessKey struct {
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	UserID    int    `json:"user_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TenantID  int    `json:"tenant_id,omitempty"`
+	RoleID    int    `json:"role_id,omitempty"`
+	Disabled  bool   `json:"disabled,omitempty"`
+}
+
+// AccessKeyStore looks up access keys for signature verification.
+// Implementations return ErrAccessKeyNotFound for unknown keys.
+type AccessKeyStore interface {
+	GetAccessKey(ctx context.Context, accessKey string) (*AccessKey, error)
+}
+
+// CachedAccessKeyStore caches lookups of another AccessKeyStore (usually the database).
+// Unknown keys are cached briefly as well, so random access keys cannot hammer the backend.
+// When an encryption key is configured, secrets are stored encrypted in the cache.
+type CachedAccessKeyStore struct {
+	next          AccessKeyStore
+	cache         cache.Cache
+	ttl           time.Duration
+	encryptionKey string
+}
+
+// NewCachedAccessKeyStore creates a CachedAccessKeyStore.
+// encryptionKey is a 32 bytes AES key (options.AuthOptions.EncryptionKey), empty disables encryption.
+// A ttl <= 0 means DefaultAccessKeyCacheTTL, entries always expire.
+func NewCachedAccessKeyStore(next AccessKeyStore, c cache.Cache, ttl time.Duration, encryptionKey string) *CachedAccessKeyStore {
+	if ttl <= 0 {
+		ttl = DefaultAccessKeyCacheTTL
+	}
+	return &CachedAccessKeyStore{
+		next:          next,
+		cache:         c,
+		ttl:           ttl,
+		encryptionKey: encryptionKey,
+	}
+}
+
+func (s *CachedAccessKeyStore) GetAccessKey(ctx context.Context, accessKey string) (*AccessKey, error) {
+	cacheKey := accessKeyCachePrefix + accessKey
+
+	data, err := s.cache.Get(ctx, cacheKey)
+	if err == nil {
+		if data == accessKeyNotFound {
+			return nil, ErrAccessKeyNotFound
+		}
+		if key, err := s.decode(data); err == nil {
+			return key, nil
+		}
+		// Undecodable entry (e.g. rotated encryption key), fall through to the backend
+	} else if !cache.IsMiss(err) {
+		return nil, err
+	}
+
+	key, err := s.next.GetAccessKey(ctx, accessKey)
+	if errors.Is(err, ErrAccessKeyNotFound) {
+		s.cache.Set(ctx, cacheKey, accessKeyNotFound, min(s.ttl, accessKeyNegativeTTL))
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded, err := s.encode(key); err == nil {
+		s.cache.Set(ctx, cacheKey, encoded, s.ttl)
+	}
+	return key, nil
+}
+
+// Invalidate drops a cached key, call it after disabling or rotating the key.
+// With a *cache.HybridCache the L1 entries of other pods are dropped as well.
+func (s *CachedAccessKeyStore) Invalidate(ctx context.Context, accessKey string) error {
+	cacheKey := accessKeyCachePrefix + accessKey
+	if err := s.cache.Del(ctx, cacheKey); err != nil {
+		return err
+	}
+	if h, ok := s.cache.(*cache.HybridCache); ok {
+		return cache.PublishInvalidation(ctx, h.GetRedisClient(), cacheKey)
+	}
+	return nil
+}
+
+func (s *CachedAccessKeyStore) encode(key *AccessKey) (string, error) {
+	stored := *key
+	if s.encryptionKey != "" {
+		secret, err := crypto.Encrypt(stored.SecretKey, s.encryptionKey)
+		if err != nil {
+			return "", err
+		}
+		stored.SecretKey = secret
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *CachedAccessKeyStore) decode(data string) (*AccessKey, error) {
+	var key AccessKey
+	if err := json.Unmarshal([]byte(data), &key); err != nil {
+		return nil, err
+	}
+	if s.encryptionKey != "" {
+		secret, err := crypto.Decrypt(key.SecretKey, s.encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		key.SecretKey = secret
+	}
+	return &key, nil
+}
+
+// WithAccessKey returns a new context carrying the identity of the access key owner
+func WithAccessKey(ctx context.Context, key *AccessKey) context.Context {
+	return WithClaims(ctx, &Claims{
+		UserID:   key.UserID,
+		Username: key.Username,
+		TenantID: key.TenantID,
+		RoleID:   key.RoleID,
+	})
+}
+
+// ParseAuthorization parses a "Nuwa <AccessKey>:<Signature>" header value
+func ParseAuthorization(header string) (accessKey, signature string, err error) {
+	scheme, value, ok := strings.Cut(header, " ")
+	if !ok || scheme != "Nuwa" {
+		return "", "", fmt.Errorf("invalid authorization scheme")
+	}
+	accessKey, signature, ok = strings.Cut(strings.TrimSpace(value), ":")
+	if !ok || accessKey == "" || signature == "" {
+		return "", "", fmt.Errorf("invalid authorization format")
+	}
+	return accessKey, signature, nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnsupportedKey is returned for key types that cannot sign or verify tokens
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// SigningMethodForKey returns the JWT algorithm implied by a private or public key:
+// RSA -> RS256, ECDSA P-256/P-384/P-521 -> ES256/ES384/ES512, Ed25519 -> EdDSA.
+func SigningMethodForKey(key interface{}) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		return ecdsaSigningMethod(k.Curve)
+	case *ecdsa.PublicKey:
+		return ecdsaSigningMethod(k.Curve)
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+}
+
+// signingMethodFor returns the JWT algorithm of a key declared with alg (e.g. the
+// alg member of a JWK). An empty alg is the one implied by the key; RSA keys may
+// also declare RS384, RS512 or PS256/PS384/PS512, other key types only their own.
+func signingMethodFor(key interface{}, alg string) (jwt.SigningMethod, error) {
+	implied, err := SigningMethodForKey(key)
+	if err != nil || alg == "" || alg == implied.Alg() {
+		return implied, err
+	}
+	switch method := jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if _, ok := implied.(*jwt.SigningMethodRSA); ok {
+			return method, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: alg %s for %T", ErrUnsupportedKey, alg, key)
+}
+
+func ecdsaSigningMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, fmt.Errorf("%w: ecdsa curve %s", ErrUnsupportedKey, curve.Params().Name)
+	}
+}
+
+// publicKeyOf returns the public half of a private key
+func publicKeyOf(priv crypto.PrivateKey) (crypto.PublicKey, error) {
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, priv)
+	}
+	return signer.Public(), nil
+}
+
+// signToken signs claims with alg, or the algorithm implied by the key if empty
+func signToken(claims jwt.Claims, signKey crypto.PrivateKey, alg string, header map[string]interface{}) (string, error) {
+	method, err := signingMethodFor(signKey, alg)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	for k, v := range header {
+		token.Header[k] = v
+	}
+	return token.SignedString(signKey)
+}
+
+// checkTokenAlgorithm rejects tokens whose alg header does not match the key
+// and its declared alg (empty for the one implied by the key).
+// This is stricter than checking the algorithm family: an ES256 key never
+// verifies an ES384 token, and an RS256 key never verifies a PS256 token.
+func checkTokenAlgorithm(token *jwt.Token, verifyKey crypto.PublicKey, alg string) error {
+	method, err := signingMethodFor(verifyKey, alg)
+	if err != nil {
+		return err
+	}
+	if token.Method == nil || token.Method.Alg() != method.Alg() {
+		return fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return nil
+}
+
+// staticKeyfunc returns a jwt.Keyfunc for a single verification key
+func staticKeyfunc(verifyKey crypto.PublicKey) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		if err := checkTokenAlgorithm(token, verifyKey, ""); err != nil {
+			return nil, err
+		}
+		return verifyKey, nil
+	}
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// hibpIndexMagic starts a binary index built by BuildHIBPIndex, followed by
+// sorted records of a 20 bytes SHA-1 and a big-endian uint32 count
+var hibpIndexMagic = []byte("HIBPIDX1")
+
+const (
+	hibpRecordSize = sha1.Size + 4
+	hibpPrefixLen  = 5 // Hex characters of the k-anonymity range prefixes
+)
+
+// BreachChecker reports how often a password appears in known breaches
+type BreachChecker interface {
+	Occurrences(password string) (int, error)
+}
+
+// BreachFile is a BreachChecker over a local Have I Been Pwned dump.
+// Lookups binary-search the file with ReadAt, or read a single range file,
+// nothing is loaded in memory.
+type BreachFile struct {
+	f      *os.File
+	size   int64
+	binary bool
+	dir    string // Range dump directory
+}
+
+// OpenBreachFile opens one of:
+//   - the SHA-1 "ordered by hash" HIBP dump (lines of HASH:COUNT, sorted)
+//   - a binary index built by BuildHIBPIndex
+//   - a directory of the SHA-1 range dump written by the PwnedPasswordsDownloader,
+//     one file per 5 hex characters prefix ("21BD1" or "21BD1.txt") of SUFFIX:COUNT lines
+func OpenBreachFile(path string) (*BreachFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return &BreachFile{dir: path}, nil
+	}
+
+	b := &BreachFile{f: f, size: info.Size()}
+	magic := make([]byte, len(hibpIndexMagic))
+	if _, err := f.ReadAt(magic, 0); err == nil && bytes.Equal(magic, hibpIndexMagic) {
+		b.binary = true
+		if (b.size-int64(len(magic)))%hibpRecordSize != 0 {
+			f.Close()
+			return nil, fmt.Errorf("corrupt hibp index %s", path)
+		}
+	}
+	return b, nil
+}
+
+// Occurrences returns the breach count of the password, 0 if unknown
+func (b *BreachFile) Occurrences(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	if b.dir != "" {
+		return b.lookupRange(strings.ToUpper(hex.EncodeToString(sum[:])))
+	}
+	if b.binary {
+		return b.lookupBinary(sum[:])
+	}
+	return b.lookupText(strings.ToUpper(hex.EncodeToString(sum[:])))
+}
+
+func (b *BreachFile) Close() error {
+	if b.f == nil {
+		return nil
+	}
+	return b.f.Close()
+}
+
+// lookupRange scans the range file of the hash prefix. A missing file is an
+// error rather than a miss, as every prefix exists in a complete dump.
+func (b *BreachFile) lookupRange(target string) (int, error) {
+	prefix, suffix := target[:hibpPrefixLen], target[hibpPrefixLen:]
+	f, err := os.Open(filepath.Join(b.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(b.dir, prefix))
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && strings.EqualFold(hash, suffix) {
+			return strconv.Atoi(count)
+		}
+	}
+	return 0, scanner.Err()
+}
+
+func (b *BreachFile) lookupBinary(sum []byte) (int, error) {
+	offset := int64(len(hibpIndexMagic))
+	lo, hi := int64(0), (b.size-offset)/hibpRecordSize
+	record := make([]byte, hibpRecordSize)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if _, err := b.f.ReadAt(record, offset+mid*hibpRecordSize); err != nil {
+			return 0, err
+		}
+		switch c := bytes.Compare(record[:sha1.Size], sum); {
+		case c == 0:
+			return int(binary.BigEndian.Uint32(record[sha1.Size:])), nil
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return 0, nil
+}
+
+// lookupText binary-searches byte offsets. Invariant: lines starting before
+// lo hash below the target, lines starting at or after hi do not.
+func (b *BreachFile) lookupText(target string) (int, error) {
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, next, err := b.lineFrom(mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi || line == "" {
+			hi = mid
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); strings.ToUpper(hash) < target {
+			lo = next
+		} else {
+			hi = mid
+		}
+	}
+
+	_, line, _, err := b.lineFrom(lo)
+	if err != nil {
+		return 0, err
+	}
+	hash, count, _ := strings.Cut(line, ":")
+	if strings.ToUpper(hash) != target {
+		return 0, nil
+	}
+	return strconv.Atoi(strings.TrimSpace(count))
+}
+
+// lineFrom returns the first line starting at or after pos, its start and the
+// start of the following line. line is empty at the end of the file.
+func (b *BreachFile) lineFrom(pos int64) (start int64, line string, next int64, err error) {
+	start = pos
+	if pos > 0 {
+		// The line starts after the first newline at or after pos-1
+		r := bufio.NewReaderSize(io.NewSectionReader(b.f, pos-1, b.size-pos+1), 128)
+		skipped, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return 0, "", 0, err
+		}
+		start = pos - 1 + int64(len(skipped))
+	}
+	if start >= b.size {
+		return b.size, "", b.size, nil
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(b.f, start, b.size-start), 128)
+	raw, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", 0, err
+	}
+	return start, strings.TrimRight(raw, "\r\n"), start + int64(len(raw)), nil
+}
+
+// BuildHIBPIndex converts a sorted HASH:COUNT dump into the compact binary
+// index (24 bytes per hash instead of about 50) read by OpenBreachFile.
+// Counts above the uint32 range are clamped.
+func BuildHIBPIndex(src io.Reader, dst io.Writer) error {
+	w := bufio.NewWriter(dst)
+	if _, err := w.Write(hibpIndexMagic); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(src)
+	record := make([]byte, hibpRecordSize)
+	var prev []byte
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash, countStr, ok := strings.Cut(line, ":")
+		sum, err := hex.DecodeString(hash)
+		if !ok || err != nil || len(sum) != sha1.Size {
+			return fmt.Errorf("invalid hibp line %q", line)
+		}
+		if prev != nil && bytes.Compare(sum, prev) <= 0 {
+			return errors.New("hibp dump must be sorted by hash")
+		}
+		count, err := strconv.ParseUint(countStr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid hibp line %q", line)
+		}
+
+		copy(record, sum)
+		binary.BigEndian.PutUint32(record[sha1.Size:], uint32(min(count, 1<<32-1)))
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+		prev = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
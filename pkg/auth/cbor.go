@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+)
+
+// Minimal CBOR (RFC 8949) decoder for WebAuthn attestation objects and COSE keys.
+// Only definite lengths are supported, as required by CTAP2 canonical encoding.
+// Values decode to int64, []byte, string, []interface{}, map[interface{}]interface{},
+// bool, float64 or nil.
+
+const cborMaxDepth = 16
+
+var errCBOR = errors.New("invalid cbor")
+
+// cborDecode decodes the first item of data and returns the number of bytes it used
+func cborDecode(data []byte) (interface{}, int, error) {
+	return cborDecodeItem(data, 0)
+}
+
+func cborDecodeItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > cborMaxDepth {
+		return nil, 0, fmt.Errorf("%w: nesting too deep", errCBOR)
+	}
+	if len(data) == 0 {
+		return nil, 0, fmt.Errorf("%w: unexpected end", errCBOR)
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	arg, n, err := cborArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0: // Unsigned integer
+		if arg > math.MaxInt64 {
+			return nil, 0, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(arg), n, nil
+
+	case 1: // Negative integer
+		if arg > math.MaxInt64 {
+			return nil, 0, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(arg), n, nil
+
+	case 2, 3: // Byte and text strings
+		if arg > uint64(len(data)-n) {
+			return nil, 0, fmt.Errorf("%w: string exceeds input", errCBOR)
+		}
+		b := data[n : n+int(arg)]
+		if major == 3 {
+			return string(b), n + int(arg), nil
+		}
+		return append([]byte(nil), b...), n + int(arg), nil
+
+	case 4: // Array
+		if arg > uint64(len(data)-n) {
+			return nil, 0, fmt.Errorf("%w: array exceeds input", errCBOR)
+		}
+		arr := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, m, err := cborDecodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			arr = append(arr, v)
+			n += m
+		}
+		return arr, n, nil
+
+	case 5: // Map
+		if arg > uint64(len(data)-n) {
+			return nil, 0, fmt.Errorf("%w: map exceeds input", errCBOR)
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, kn, err := cborDecodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += kn
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, 0, fmt.Errorf("%w: unsupported map key %T", errCBOR, k)
+			}
+			v, vn, err := cborDecodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += vn
+			if _, dup := m[k]; dup {
+				return nil, 0, fmt.Errorf("%w: duplicate map key", errCBOR)
+			}
+			m[k] = v
+		}
+		return m, n, nil
+
+	case 6: // Tag, the tagged item is returned as is
+		v, m, err := cborDecodeItem(data[n:], depth+1)
+		return v, n + m, err
+
+	default: // Simple values and floats
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22, 23:
+			return nil, n, nil
+		case 25:
+			return float64(halfToFloat(uint16(arg))), n, nil
+		case 26:
+			return float64(math.Float32frombits(uint32(arg))), n, nil
+		case 27:
+			return math.Float64frombits(arg), n, nil
+		}
+		return nil, 0, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+	}
+}
+
+// cborArgument reads the argument following the initial byte
+func cborArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24 && len(data) >= 2:
+		return uint64(data[1]), 2, nil
+	case info == 25 && len(data) >= 3:
+		return uint64(binary.BigEndian.Uint16(data[1:])), 3, nil
+	case info == 26 && len(data) >= 5:
+		return uint64(binary.BigEndian.Uint32(data[1:])), 5, nil
+	case info == 27 && len(data) >= 9:
+		return binary.BigEndian.Uint64(data[1:]), 9, nil
+	case info == 31:
+		return 0, 0, fmt.Errorf("%w: indefinite length", errCBOR)
+	default:
+		return 0, 0, fmt.Errorf("%w: truncated argument", errCBOR)
+	}
+}
+
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h & 0x3ff)
+	switch exp {
+	case 0:
+		f := float32(frac) / 1024 / 16384
+		if sign != 0 {
+			return -f
+		}
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+}
+
+// COSE algorithm identifiers (RFC 9053) supported for WebAuthn credentials
+const (
+	COSEAlgES256 int64 = -7
+	COSEAlgES384 int64 = -35
+	COSEAlgES512 int64 = -36
+	COSEAlgEdDSA int64 = -8
+	COSEAlgRS256 int64 = -257
+)
+
+// COSE key parameters
+const (
+	coseKty    = 1
+	coseAlg    = 3
+	coseCrv    = -1
+	coseX      = -2
+	coseY      = -3
+	coseRSAN   = -1
+	coseRSAE   = -2
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+)
+
+// parseCOSEKey decodes a COSE_Key into a public key and its algorithm,
+// and returns the number of bytes used
+func parseCOSEKey(data []byte) (crypto.PublicKey, int64, int, error) {
+	v, n, err := cborDecode(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, 0, errors.New("cose key is not a map")
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch kty {
+	case coseKtyEC2:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		var curve elliptic.Curve
+		switch {
+		case crv == 1 && alg == COSEAlgES256:
+			curve = elliptic.P256()
+		case crv == 2 && alg == COSEAlgES384:
+			curve = elliptic.P384()
+		case crv == 3 && alg == COSEAlgES512:
+			curve = elliptic.P521()
+		default:
+			return nil, 0, 0, fmt.Errorf("unsupported ec2 key crv %d alg %d", crv, alg)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := pub.ECDH(); err != nil {
+			return nil, 0, 0, fmt.Errorf("invalid ec2 key: %w", err)
+		}
+		return pub, alg, n, nil
+
+	case coseKtyOKP:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != 6 || alg != COSEAlgEdDSA || len(x) != ed25519.PublicKeySize {
+			return nil, 0, 0, fmt.Errorf("unsupported okp key crv %d alg %d", crv, alg)
+		}
+		return ed25519.PublicKey(x), alg, n, nil
+
+	case coseKtyRSA:
+		nBytes, _ := m[int64(coseRSAN)].([]byte)
+		eBytes, _ := m[int64(coseRSAE)].([]byte)
+		if alg != COSEAlgRS256 || len(nBytes) < 256 || len(eBytes) == 0 || len(eBytes) > 4 {
+			return nil, 0, 0, fmt.Errorf("unsupported rsa key alg %d", alg)
+		}
+		e := new(big.Int).SetBytes(eBytes)
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(e.Int64())}, alg, n, nil
+
+	default:
+		return nil, 0, 0, fmt.Errorf("unsupported cose key type %d", kty)
+	}
+}
+
+// verifyCOSESignature verifies a WebAuthn signature (ASN.1 DER for ECDSA)
+func verifyCOSESignature(pub crypto.PublicKey, alg int64, data, sig []byte) error {
+	var h hash.Hash
+	var cryptoHash crypto.Hash
+	switch alg {
+	case COSEAlgES256, COSEAlgRS256:
+		h, cryptoHash = sha256.New(), crypto.SHA256
+	case COSEAlgES384:
+		h, cryptoHash = sha512.New384(), crypto.SHA384
+	case COSEAlgES512:
+		h, cryptoHash = sha512.New(), crypto.SHA512
+	case COSEAlgEdDSA:
+	default:
+		return fmt.Errorf("unsupported cose algorithm %d", alg)
+	}
+
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if h == nil || alg == COSEAlgRS256 {
+			break
+		}
+		h.Write(data)
+		if ecdsa.VerifyASN1(k, h.Sum(nil), sig) {
+			return nil
+		}
+		return errors.New("ecdsa signature mismatch")
+	case *rsa.PublicKey:
+		if alg != COSEAlgRS256 {
+			break
+		}
+		h.Write(data)
+		return rsa.VerifyPKCS1v15(k, cryptoHash, h.Sum(nil), sig)
+	case ed25519.PublicKey:
+		if alg != COSEAlgEdDSA {
+			break
+		}
+		if ed25519.Verify(k, data, sig) {
+			return nil
+		}
+		return errors.New("ed25519 signature mismatch")
+	}
+	return fmt.Errorf("cose algorithm %d does not match key %T", alg, pub)
+}
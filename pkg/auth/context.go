@@ -1,44 +1,70 @@
 package auth
 
-import "context"
+import (
+	"context"
+	"strconv"
+)
 
 type contextKey string
 
-const (
-	userIDKey   contextKey = "userID"
-	usernameKey contextKey = "username"
-	tenantIDKey contextKey = "tenantID"
-)
+const claimsKey contextKey = "claims"
+
+// The helpers below predate Principal and read or update the context principal.
 
 // WithUserID returns a new context with the given user ID
 func WithUserID(ctx context.Context, userID int) context.Context {
-	return context.WithValue(ctx, userIDKey, userID)
+	return updatePrincipal(ctx, func(p *Principal) { p.UserID = strconv.Itoa(userID) })
 }
 
-// UserIDFromContext returns the user ID from the context
+// UserIDFromContext returns the user ID from the context, false if absent or not numeric
 func UserIDFromContext(ctx context.Context) (int, bool) {
-	v, ok := ctx.Value(userIDKey).(int)
-	return v, ok
+	return principalIntID(ctx, func(p *Principal) string { return p.UserID })
 }
 
 // WithUsername returns a new context with the given username
 func WithUsername(ctx context.Context, username string) context.Context {
-	return context.WithValue(ctx, usernameKey, username)
+	return updatePrincipal(ctx, func(p *Principal) { p.Username = username })
 }
 
 // UsernameFromContext returns the username from the context
 func UsernameFromContext(ctx context.Context) (string, bool) {
-	v, ok := ctx.Value(usernameKey).(string)
-	return v, ok
+	p, ok := PrincipalFromContext(ctx)
+	if !ok || p.Username == "" {
+		return "", false
+	}
+	return p.Username, true
 }
 
 // WithTenantID returns a new context with the given tenant ID
 func WithTenantID(ctx context.Context, tenantID int) context.Context {
-	return context.WithValue(ctx, tenantIDKey, tenantID)
+	return updatePrincipal(ctx, func(p *Principal) { p.TenantID = strconv.Itoa(tenantID) })
 }
 
-// TenantIDFromContext returns the tenant ID from the context
+// TenantIDFromContext returns the tenant ID from the context, false if absent or not numeric
 func TenantIDFromContext(ctx context.Context) (int, bool) {
-	v, ok := ctx.Value(tenantIDKey).(int)
+	return principalIntID(ctx, func(p *Principal) string { return p.TenantID })
+}
+
+// WithRoleID returns a new context with the given role ID (STS sessions)
+func WithRoleID(ctx context.Context, roleID int) context.Context {
+	return updatePrincipal(ctx, func(p *Principal) { p.RoleID = strconv.Itoa(roleID) })
+}
+
+// RoleIDFromContext returns the role ID from the context, false if absent or not numeric
+func RoleIDFromContext(ctx context.Context) (int, bool) {
+	return principalIntID(ctx, func(p *Principal) string { return p.RoleID })
+}
+
+// WithClaims returns a new context with the verified token claims and the
+// principal they carry (see PrincipalFromClaims), so the *FromContext
+// helpers work without further plumbing.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, claimsKey, claims)
+	return WithPrincipal(ctx, PrincipalFromClaims(claims))
+}
+
+// ClaimsFromContext returns the verified token claims from the context
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	v, ok := ctx.Value(claimsKey).(*Claims)
 	return v, ok
 }
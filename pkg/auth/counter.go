@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+)
+
+// incrWithTTLScript increments a counter and sets its expiry on creation,
+// so counters never outlive their window (plain INCR would leave them forever).
+const incrWithTTLScript = `
+local v = redis.call('INCR', KEYS[1])
+if v == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return v`
+
+// incrWithTTL atomically increments key and returns the new value
+func incrWithTTL(ctx context.Context, c cache.Cache, key string, ttl time.Duration) (int64, error) {
+	res, err := c.Eval(ctx, incrWithTTLScript, []string{key}, ttl.Milliseconds())
+	if err != nil {
+		return 0, err
+	}
+	n, ok := res.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected counter result type: %T", res)
+	}
+	return n, nil
+}
+
+// remoteCache returns the Redis store of a HybridCache. State read back after
+// an Eval, or changed by other pods, must bypass the local L1 copies.
+func remoteCache(c cache.Cache) cache.Cache {
+	if h, ok := c.(*cache.HybridCache); ok {
+		return h.Remote()
+	}
+	return c
+}
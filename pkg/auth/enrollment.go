@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	"github.com/arrow2012/nuwa-kit/pkg/crypto"
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+)
+
+const (
+	totpPendingPrefix  = "auth:totp:pending:"
+	totpAttemptsPrefix = "auth:totp:attempts:"
+
+	// DefaultEnrollmentTTL is how long a pending TOTP secret waits for its confirmation code
+	DefaultEnrollmentTTL = 10 * time.Minute
+	// MaxEnrollmentAttempts wrong confirmation codes discard the pending secret
+	MaxEnrollmentAttempts = 5
+)
+
+// TOTPEnrollment is a pending enrollment, shown to the user as a QR code
+type TOTPEnrollment struct {
+	Secret    string    `json:"secret"` // For manual entry
+	URL       string    `json:"url"`    // otpauth:// URL
+	QRCode    []byte    `json:"qr_code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TOTPActivation is the result of a confirmed enrollment.
+// Persist EncryptedSecret and HashedRecoveryCodes; show RecoveryCodes to the user once.
+type TOTPActivation struct {
+	EncryptedSecret     string   `json:"-"`
+	RecoveryCodes       []string `json:"recovery_codes"`
+	HashedRecoveryCodes []string `json:"-"`
+}
+
+// TOTPEnrollmentManager runs the enrollment flow:
+// Begin (pending secret in cache) -> Confirm (first valid code) -> activated secret to persist.
+//
+// Secrets are encrypted with crypto.Encrypt, in the cache and in the activation.
+// Re-enrolling is a new Begin/Confirm: the previous secret stays valid until the
+// caller replaces it with the new activation.
+type TOTPEnrollmentManager struct {
+	totp          *TOTP
+	cache         cache.Cache
+	encryptionKey string
+	ttl           time.Duration
+}
+
+// NewTOTPEnrollmentManager creates a TOTPEnrollmentManager.
+// encryptionKey is options.AuthOptions.EncryptionKey, ttl defaults to DefaultEnrollmentTTL.
+func NewTOTPEnrollmentManager(t *TOTP, c cache.Cache, encryptionKey string, ttl time.Duration) *TOTPEnrollmentManager {
+	if ttl <= 0 {
+		ttl = DefaultEnrollmentTTL
+	}
+	return &TOTPEnrollmentManager{
+		totp:          t,
+		cache:         c,
+		encryptionKey: encryptionKey,
+		ttl:           ttl,
+	}
+}
+
+// Begin generates a secret and keeps it pending, replacing any previous pending enrollment
+func (m *TOTPEnrollmentManager) Begin(ctx context.Context, userID int, accountName string) (*TOTPEnrollment, error) {
+	key, err := m.totp.Generate(accountName)
+	if err != nil {
+		return nil, err
+	}
+	qr, err := GenerateQRCode(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := crypto.Encrypt(key.Secret(), m.encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	uid := strconv.Itoa(userID)
+	if err := m.cache.Set(ctx, totpPendingPrefix+uid, encrypted, m.ttl); err != nil {
+		return nil, err
+	}
+	if err := m.cache.Del(ctx, totpAttemptsPrefix+uid); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:    key.Secret(),
+		URL:       key.URL(),
+		QRCode:    qr,
+		ExpiresAt: time.Now().Add(m.ttl),
+	}, nil
+}
+
+// Confirm activates the pending secret if the passcode is valid, and generates recovery codes.
+// Errors are errors.ErrMFAEnrollment (nothing pending), ErrMFACodeInvalid, or
+// ErrTooManyRequests after MaxEnrollmentAttempts wrong codes (the enrollment is discarded).
+func (m *TOTPEnrollmentManager) Confirm(ctx context.Context, userID int, passcode string) (*TOTPActivation, error) {
+	uid := strconv.Itoa(userID)
+	encrypted, err := m.cache.Get(ctx, totpPendingPrefix+uid)
+	if err != nil {
+		if cache.IsMiss(err) {
+			return nil, apperrors.ErrMFAEnrollment
+		}
+		return nil, err
+	}
+	secret, err := crypto.Decrypt(encrypted, m.encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt pending totp secret: %w", err)
+	}
+
+	// Consumes the step, so the confirmation code cannot be replayed to log in
+	ok, err := m.totp.Validate(ctx, userID, passcode, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		attempts, err := incrWithTTL(ctx, m.cache, totpAttemptsPrefix+uid, m.ttl)
+		if err != nil {
+			return nil, err
+		}
+		if attempts >= MaxEnrollmentAttempts {
+			if err := m.Cancel(ctx, userID); err != nil {
+				return nil, err
+			}
+			return nil, apperrors.ErrTooManyRequests
+		}
+		return nil, apperrors.ErrMFACodeInvalid
+	}
+
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := HashRecoveryCodes(codes)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Cancel(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return &TOTPActivation{
+		EncryptedSecret:     encrypted,
+		RecoveryCodes:       codes,
+		HashedRecoveryCodes: hashed,
+	}, nil
+}
+
+// Cancel discards the pending enrollment
+func (m *TOTPEnrollmentManager) Cancel(ctx context.Context, userID int) error {
+	uid := strconv.Itoa(userID)
+	if err := m.cache.Del(ctx, totpPendingPrefix+uid); err != nil {
+		return err
+	}
+	return m.cache.Del(ctx, totpAttemptsPrefix+uid)
+}
+
+// Verify checks a login passcode against the persisted encrypted secret (single use)
+func (m *TOTPEnrollmentManager) Verify(ctx context.Context, userID int, passcode, encryptedSecret string) (bool, error) {
+	secret, err := crypto.Decrypt(encryptedSecret, m.encryptionKey)
+	if err != nil {
+		return false, fmt.Errorf("decrypt totp secret: %w", err)
+	}
+	return m.totp.Validate(ctx, userID, passcode, secret)
+}
+
+// Disable requires a current passcode before the caller deletes the persisted
+// secret and recovery codes, and discards any pending re-enrollment.
+// Returns errors.ErrMFACodeInvalid for a wrong code.
+func (m *TOTPEnrollmentManager) Disable(ctx context.Context, userID int, passcode, encryptedSecret string) error {
+	ok, err := m.Verify(ctx, userID, passcode, encryptedSecret)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apperrors.ErrMFACodeInvalid
+	}
+	return m.Cancel(ctx, userID)
+}
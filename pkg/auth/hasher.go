@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrPasswordTooLong is returned by bcrypt for passwords over 72 bytes, instead of truncating them
+	ErrPasswordTooLong = errors.New("password exceeds 72 bytes, the bcrypt limit")
+	// ErrUnsupportedHash is returned for hashes that are neither argon2id nor bcrypt
+	ErrUnsupportedHash = errors.New("unsupported password hash format")
+	// ErrInvalidHash is returned for malformed argon2id hashes
+	ErrInvalidHash = errors.New("invalid password hash")
+)
+
+// Limits on the parameters of stored argon2id hashes, so that a tampered hash
+// cannot make Verify allocate gigabytes or spin for minutes
+const (
+	argon2MaxMemory      = 1 << 20 // KiB (1 GiB)
+	argon2MaxIterations  = 64
+	argon2MaxParallelism = 64
+	argon2MaxKeyLength   = 1024
+	argon2LimitFactor    = 4 // Times the configured parameters, when set
+)
+
+// PasswordHasher hashes and verifies passwords.
+//
+// On login, verify the password and if NeedsRehash reports true, store a new
+// Hash of it: old bcrypt hashes are upgraded to the current algorithm and parameters.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// NewPasswordHasher creates a PasswordHasher hashing with opts.Algorithm and
+// verifying both argon2id and bcrypt hashes. opts must pass Validate (after Complete).
+func NewPasswordHasher(opts *options.PasswordOptions) (PasswordHasher, error) {
+	if errs := opts.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("password options: %w", errors.Join(errs...))
+	}
+	h := &passwordHasher{
+		argon2: &Argon2idHasher{
+			Memory:      opts.Argon2Memory,
+			Iterations:  opts.Argon2Iterations,
+			Parallelism: opts.Argon2Parallelism,
+			SaltLength:  opts.Argon2SaltLength,
+			KeyLength:   opts.Argon2KeyLength,
+		},
+		bcrypt: &BcryptHasher{Cost: opts.BcryptCost},
+	}
+	h.current = h.argon2
+	if opts.Algorithm == "bcrypt" {
+		h.current = h.bcrypt
+	}
+	return h, nil
+}
+
+type passwordHasher struct {
+	current PasswordHasher
+	argon2  *Argon2idHasher
+	bcrypt  *BcryptHasher
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *passwordHasher) Verify(password, hash string) (bool, error) {
+	switch {
+	case isArgon2idHash(hash):
+		return h.argon2.Verify(password, hash)
+	case isBcryptHash(hash):
+		return h.bcrypt.Verify(password, hash)
+	default:
+		return false, ErrUnsupportedHash
+	}
+}
+
+func (h *passwordHasher) NeedsRehash(hash string) bool {
+	return h.current.NeedsRehash(hash)
+}
+
+// Argon2idHasher hashes with argon2id into the PHC string format
+// $argon2id$v=19$m=<KiB>,t=<iterations>,p=<lanes>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify uses the parameters stored in the hash, not those of the hasher.
+// Hashes with parameters over 4 times the configured ones, or over fixed maximums
+// for a zero hasher, are rejected with ErrInvalidHash.
+func (h *Argon2idHasher) Verify(password, hash string) (bool, error) {
+	p, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	if p.memory > argon2Limit(h.Memory, argon2MaxMemory) || p.iterations > argon2Limit(h.Iterations, argon2MaxIterations) ||
+		uint32(p.parallelism) > argon2Limit(uint32(h.Parallelism), argon2MaxParallelism) ||
+		uint32(len(p.key)) > argon2Limit(h.KeyLength, argon2MaxKeyLength) {
+		return false, ErrInvalidHash
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	p, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return p.memory != h.Memory || p.iterations != h.Iterations || p.parallelism != h.Parallelism ||
+		uint32(len(p.salt)) != h.SaltLength || uint32(len(p.key)) != h.KeyLength
+}
+
+// argon2Limit is argon2LimitFactor times the configured value, capped at limit
+// unless the configured value itself is higher
+func argon2Limit(configured, limit uint32) uint32 {
+	switch {
+	case configured == 0:
+		return limit
+	case configured >= limit:
+		return configured
+	case uint64(configured)*argon2LimitFactor > uint64(limit):
+		return limit
+	default:
+		return configured * argon2LimitFactor
+	}
+}
+
+func isArgon2idHash(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func decodeArgon2id(hash string) (*argon2Params, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrInvalidHash
+	}
+
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if p.iterations == 0 || p.parallelism == 0 {
+		return nil, ErrInvalidHash
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return nil, ErrInvalidHash
+	}
+	return p, nil
+}
+
+// BcryptHasher hashes with bcrypt. Passwords over 72 bytes are rejected.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(b), err
+}
+
+func (h *BcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword), errors.Is(err, bcrypt.ErrPasswordTooLong):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
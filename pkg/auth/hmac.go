@@ -1,15 +1,14 @@
 package auth
 
 import (
-	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -19,18 +18,16 @@ const (
 )
 
 // SignRequest calculates the signature and adds the Authorization header to the request.
-// It also sets X-Nuwa-Date if not present.
+// It also sets X-Nuwa-Date if not present, and signs X-Nuwa-Nonce if set.
 // Format: Nuwa <AccessKey>:<Signature>
+//
+// New clients should use SignerV2, which signs headers and is replay-resistant.
 func SignRequest(req *http.Request, accessKey, secretKey string) error {
 	if req.Header.Get(HeaderNuwaDate) == "" {
-		// return fmt.Errorf("X-Nuwa-Date header is required")
-		// Ideally client sets it, but helper can default?
-		// Let's enforce it being present or passed as arg?
-		// For simplicity, let's assume caller sets it or we rely on standard Date if missing?
-		// No, usually signed request implies strict timestamp.
+		req.Header.Set(HeaderNuwaDate, time.Now().UTC().Format(http.TimeFormat))
 	}
 
-	stringToSign, err := buildStringToSign(req)
+	stringToSign, err := buildStringToSign(req, false)
 	if err != nil {
 		return err
 	}
@@ -41,9 +38,19 @@ func SignRequest(req *http.Request, accessKey, secretKey string) error {
 }
 
 // VerifySignature verifies the request signature.
-// Returns true if valid.
+// Returns true if valid. UNSIGNED-PAYLOAD is rejected.
+//
+// Deprecated: VerifySignature does not check the request time or nonce, so a captured
+// request can be replayed forever. Use VerifierV2.VerifyV1.
 func VerifySignature(req *http.Request, secretKey string, signatureToVerify string) (bool, error) {
-	stringToSign, err := buildStringToSign(req)
+	return verifySignatureV1(req, secretKey, signatureToVerify, false)
+}
+
+func verifySignatureV1(req *http.Request, secretKey, signatureToVerify string, allowUnsigned bool) (bool, error) {
+	if req.Header.Get(HeaderNuwaContentSHA256) == UnsignedPayload && !allowUnsigned {
+		return false, nil
+	}
+	stringToSign, err := buildStringToSign(req, true)
 	if err != nil {
 		return false, err
 	}
@@ -52,13 +59,68 @@ func VerifySignature(req *http.Request, secretKey string, signatureToVerify stri
 	return hmac.Equal([]byte(signatureToVerify), []byte(expectedSignature)), nil
 }
 
+// GRPCCall is the part of a gRPC call covered by SignGRPC
+type GRPCCall struct {
+	FullMethod string
+	Date       string // RFC 3339, sent as x-nuwa-date
+	Nonce      string // Sent as x-nuwa-nonce, may be empty
+
+	// Metadata holds the signed metadata, keyed by lower-case name as in metadata.MD
+	Metadata map[string][]string
+
+	// PayloadHash is the hex SHA-256 of the marshalled request,
+	// UnsignedPayload for streams
+	PayloadHash string
+}
+
+// SignGRPC signs a gRPC call and returns the authorization metadata value.
+// Format: Nuwa <AccessKey>:<Signature>
+func SignGRPC(accessKey, secretKey string, call *GRPCCall) string {
+	signature := calculateSignature(secretKey, grpcStringToSign(call))
+	return fmt.Sprintf("Nuwa %s:%s", accessKey, signature)
+}
+
+// VerifyGRPCSignature verifies a signature produced by SignGRPC
+func VerifyGRPCSignature(secretKey string, call *GRPCCall, signatureToVerify string) bool {
+	expectedSignature := calculateSignature(secretKey, grpcStringToSign(call))
+	return hmac.Equal([]byte(signatureToVerify), []byte(expectedSignature))
+}
+
+func grpcStringToSign(call *GRPCCall) string {
+	names := make([]string, 0, len(call.Metadata))
+	for name := range call.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var md strings.Builder
+	for _, name := range names {
+		md.WriteString(name)
+		md.WriteByte(':')
+		md.WriteString(strings.Join(call.Metadata[name], ","))
+		md.WriteByte('\n')
+	}
+
+	// Format:
+	// GRPC
+	// FullMethod
+	// Date
+	// Nonce
+	// name:value lines of the signed metadata
+	// Signed metadata names joined by ';'
+	// PayloadHash
+	return fmt.Sprintf("GRPC\n%s\n%s\n%s\n%s%s\n%s",
+		call.FullMethod, call.Date, call.Nonce, md.String(), strings.Join(names, ";"), call.PayloadHash)
+}
+
 func calculateSignature(secretKey, stringToSign string) string {
 	h := hmac.New(sha256.New, []byte(secretKey))
 	h.Write([]byte(stringToSign))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-func buildStringToSign(req *http.Request) (string, error) {
+// buildStringToSign hashes the body unless X-Nuwa-Content-Sha256 is set,
+// verify wraps the body to check a declared hash while it is read
+func buildStringToSign(req *http.Request, verify bool) (string, error) {
 	// 1. Method
 	method := req.Method
 
@@ -86,27 +148,12 @@ func buildStringToSign(req *http.Request) (string, error) {
 	queryString := strings.Join(queryParts, "&")
 
 	// 4. Date
-	date := req.Header.Get(HeaderNuwaDate)
-	if date == "" {
-		// Fallback to Date header
-		date = req.Header.Get("Date")
-	}
+	date := v1Date(req)
 
 	// 5. Body Hash
-	bodyHash := ""
-	if req.Body != nil {
-		bodyBytes, err := io.ReadAll(req.Body)
-		if err != nil {
-			return "", err
-		}
-		// Restore body
-		req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-		hash := sha256.Sum256(bodyBytes)
-		bodyHash = hex.EncodeToString(hash[:])
-	} else {
-		hash := sha256.Sum256([]byte(""))
-		bodyHash = hex.EncodeToString(hash[:])
+	bodyHash, err := payloadHash(req, verify)
+	if err != nil {
+		return "", err
 	}
 
 	// Format:
@@ -116,5 +163,18 @@ func buildStringToSign(req *http.Request) (string, error) {
 	// Date
 	// BodyHash
 	stringToSign := fmt.Sprintf("%s\n%s\n%s\n%s\n%s", method, uri, queryString, date, bodyHash)
+
+	// Nonce, only when present so that clients without one keep their signatures
+	if nonce := req.Header.Get(HeaderNuwaNonce); nonce != "" {
+		stringToSign += "\n" + nonce
+	}
 	return stringToSign, nil
 }
+
+// v1Date is X-Nuwa-Date, falling back to the Date header
+func v1Date(req *http.Request) string {
+	if date := req.Header.Get(HeaderNuwaDate); date != "" {
+		return date
+	}
+	return req.Header.Get("Date")
+}
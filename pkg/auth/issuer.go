@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// IssueOption customizes a single token issued by TokenIssuer
+type IssueOption func(*Claims)
+
+// WithAudience overrides the default audience
+func WithAudience(aud ...string) IssueOption {
+	return func(c *Claims) {
+		c.Audience = aud
+	}
+}
+
+// WithDuration overrides the default token lifetime
+func WithDuration(d time.Duration) IssueOption {
+	return func(c *Claims) {
+		c.ExpiresAt = jwt.NewNumericDate(c.IssuedAt.Add(d))
+	}
+}
+
+// WithNotBefore delays the start of the token validity
+func WithNotBefore(t time.Time) IssueOption {
+	return func(c *Claims) {
+		c.NotBefore = jwt.NewNumericDate(t)
+	}
+}
+
+// WithScopes grants scopes (stored as the space-delimited scope claim)
+func WithScopes(scopes ...string) IssueOption {
+	return func(c *Claims) {
+		c.Scope = strings.Join(scopes, " ")
+	}
+}
+
+// WithClaim adds a custom claim under "ext"
+func WithClaim(key string, value interface{}) IssueOption {
+	return func(c *Claims) {
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{})
+		}
+		c.Extra[key] = value
+	}
+}
+
+// WithAuthentication records when and how the user authenticated (auth_time and amr).
+// Two or more methods, or AuthMethodMFA, also set MfaAuthenticated.
+// Refreshed tokens keep the time of the original login.
+func WithAuthentication(authTime time.Time, methods ...string) IssueOption {
+	return func(c *Claims) {
+		c.AuthTime = jwt.NewNumericDate(authTime)
+		c.AuthMethods = append([]string(nil), methods...)
+		if isMultiFactor(methods) {
+			c.MfaAuthenticated = true
+		}
+	}
+}
+
+// TokenIssuer issues tokens with a consistent profile (iss/aud/exp/nbf/jti)
+// taken from options.AuthOptions, signed by the active key of a KeySet.
+type TokenIssuer struct {
+	keys     *KeySet
+	issuer   string
+	audience []string
+	duration time.Duration
+}
+
+// NewTokenIssuer creates a TokenIssuer from opts.Issuer, opts.Audience and opts.TokenDuration
+func NewTokenIssuer(opts *options.AuthOptions, keys *KeySet) *TokenIssuer {
+	duration := opts.TokenDuration
+	if duration <= 0 {
+		duration = DefaultTokenDuration
+	}
+	return &TokenIssuer{
+		keys:     keys,
+		issuer:   opts.Issuer,
+		audience: opts.Audience,
+		duration: duration,
+	}
+}
+
+// Issue signs the claims after filling in the registered claims.
+// It returns the final claims as well, so callers can record the JTI and expiry.
+func (i *TokenIssuer) Issue(claims Claims, opts ...IssueOption) (string, *Claims, error) {
+	now := time.Now()
+	claims.Issuer = i.issuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(i.duration))
+	claims.ID = uuid.NewString()
+	if len(claims.Audience) == 0 && len(i.audience) > 0 {
+		claims.Audience = append(jwt.ClaimStrings(nil), i.audience...)
+	}
+	if claims.Subject == "" && claims.UserID > 0 {
+		claims.Subject = strconv.Itoa(claims.UserID)
+	}
+
+	for _, opt := range opts {
+		opt(&claims)
+	}
+
+	token, err := i.keys.Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, &claims, nil
+}
+
+// IssueUserToken is the TokenIssuer counterpart of GenerateToken
+func (i *TokenIssuer) IssueUserToken(userID int, username string, tenantID int, mfaAuth bool, opts ...IssueOption) (string, *Claims, error) {
+	return i.Issue(Claims{
+		UserID:           userID,
+		Username:         username,
+		TenantID:         tenantID,
+		MfaAuthenticated: mfaAuth,
+	}, opts...)
+}
+
+// Duration returns the default token lifetime
+func (i *TokenIssuer) Duration() time.Duration {
+	return i.duration
+}
+
+// VerifierOption customizes a TokenVerifier
+type VerifierOption func(*TokenVerifier)
+
+// WithRequiredClaims requires claims (by JSON name) to be present, e.g. "sub", "jti"
+func WithRequiredClaims(names ...string) VerifierOption {
+	return func(v *TokenVerifier) {
+		v.required = append(v.required, names...)
+	}
+}
+
+// WithLeeway overrides the clock skew leeway from options
+func WithLeeway(d time.Duration) VerifierOption {
+	return func(v *TokenVerifier) {
+		v.leeway = d
+	}
+}
+
+// WithExpectedAudience overrides the audience from options
+func WithExpectedAudience(aud ...string) VerifierOption {
+	return func(v *TokenVerifier) {
+		v.audience = aud
+	}
+}
+
+// WithRevocation rejects tokens revoked in the store
+func WithRevocation(store *RevocationStore) VerifierOption {
+	return func(v *TokenVerifier) {
+		v.revocation = store
+	}
+}
+
+// WithSessions rejects tokens whose sid claim no longer has a live session,
+// and touches the session on each verification (sliding expiration)
+func WithSessions(m *SessionManager) VerifierOption {
+	return func(v *TokenVerifier) {
+		v.sessions = m
+	}
+}
+
+// WithSessionRequired rejects tokens without a sid claim with errors.ErrSessionInvalid,
+// so that tokens issued outside a session cannot bypass WithSessions
+func WithSessionRequired() VerifierOption {
+	return func(v *TokenVerifier) {
+		v.sessionRequired = true
+	}
+}
+
+// TokenVerifier verifies tokens against the profile used by TokenIssuer:
+// signature (kid), issuer, audience, exp/nbf/iat with leeway, and required claims.
+type TokenVerifier struct {
+	keys       *KeySet
+	issuer     string
+	audience   []string
+	leeway     time.Duration
+	required   []string
+	revocation *RevocationStore
+	sessions   *SessionManager
+
+	sessionRequired bool
+}
+
+// NewTokenVerifier creates a TokenVerifier from opts.Issuer, opts.Audience and opts.Leeway
+func NewTokenVerifier(opts *options.AuthOptions, keys *KeySet, vopts ...VerifierOption) *TokenVerifier {
+	v := &TokenVerifier{
+		keys:     keys,
+		issuer:   opts.Issuer,
+		audience: opts.Audience,
+		leeway:   opts.Leeway,
+		required: []string{"exp", "iat"},
+	}
+	for _, opt := range vopts {
+		opt(v)
+	}
+	return v
+}
+
+// Verify parses and validates the token.
+// Errors are errors.ErrTokenExpired, errors.ErrTokenRevoked, errors.ErrSessionInvalid or
+// errors.ErrTokenInvalid, except for store failures which are returned as is (fail closed).
+func (v *TokenVerifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithLeeway(v.leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if v.issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(v.issuer))
+	}
+	if len(v.audience) > 0 {
+		parserOpts = append(parserOpts, jwt.WithAudience(v.audience...))
+	}
+
+	token, err := jwt.NewParser(parserOpts...).ParseWithClaims(tokenString, &Claims{}, v.keys.Keyfunc)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, apperrors.ErrTokenExpired
+		}
+		return nil, apperrors.ErrTokenInvalid
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, apperrors.ErrTokenInvalid
+	}
+
+	if err := v.checkRequired(tokenString); err != nil {
+		return nil, err
+	}
+
+	if v.revocation != nil {
+		revoked, err := v.revocation.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, apperrors.ErrTokenRevoked
+		}
+	}
+
+	sid := SessionIDFromClaims(claims)
+	if sid == "" && v.sessionRequired {
+		return nil, apperrors.ErrSessionInvalid
+	}
+	if v.sessions != nil && sid != "" {
+		if _, err := v.sessions.Touch(ctx, sid, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// checkRequired checks claim presence on the raw payload, so that zero values
+// (e.g. user_id omitted) are distinguishable from missing claims.
+func (v *TokenVerifier) checkRequired(tokenString string) error {
+	if len(v.required) == 0 {
+		return nil
+	}
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return apperrors.ErrTokenInvalid
+	}
+	payload, err := jwt.NewParser().DecodeSegment(parts[1])
+	if err != nil {
+		return apperrors.ErrTokenInvalid
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return apperrors.ErrTokenInvalid
+	}
+	for _, name := range v.required {
+		if _, ok := raw[name]; !ok {
+			return apperrors.ErrTokenInvalid
+		}
+	}
+	return nil
+}
+
+// jwksFetchTimeout bounds the download of opts.JWKSURL by KeySetFromOptions
+const jwksFetchTimeout = 10 * time.Second
+
+// KeySetFromOptions builds a KeySet from the keys in options.
+// With opts.PrivateKey the set can sign; otherwise it is verify-only, loaded
+// from opts.JWKSURL (fetched once, see FetchJWKS) or else from opts.PublicKey.
+func KeySetFromOptions(opts *options.AuthOptions) (*KeySet, error) {
+	if opts.PrivateKey == "" && opts.JWKSURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+		defer cancel()
+		return FetchJWKS(ctx, nil, opts.JWKSURL)
+	}
+
+	ks := NewKeySet()
+	switch {
+	case opts.PrivateKey != "":
+		priv, err := ParseSigningKeyFromPEM(opts.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := NewSigningKey("", priv)
+		if err != nil {
+			return nil, err
+		}
+		if err := ks.Add(key); err != nil {
+			return nil, err
+		}
+	case opts.PublicKey != "":
+		pub, err := ParseVerifyingKeyFromPEM(opts.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		kid, err := KeyThumbprint(pub)
+		if err != nil {
+			return nil, err
+		}
+		if err := ks.Add(&SigningKey{KID: kid, PublicKey: pub}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("privateKey, jwksURL or publicKey is required")
+	}
+	return ks, nil
+}
@@ -1,14 +1,18 @@
 package auth
 
 import (
-	"crypto/rsa"
+	"crypto"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// DefaultTokenDuration is the lifetime of tokens from GenerateToken
+const DefaultTokenDuration = 24 * time.Hour
+
 // Claims defines the custom claims for our JWT
 type Claims struct {
 	UserID           int    `json:"user_id,omitempty"`
@@ -16,55 +20,99 @@ type Claims struct {
 	TenantID         int    `json:"tenant_id,omitempty"`
 	RoleID           int    `json:"role_id,omitempty"` // For STS
 	MfaAuthenticated bool   `json:"mfa_authenticated,omitempty"`
+	Scope            string `json:"scope,omitempty"` // Space-delimited (RFC 8693)
+
+	// Authentication event, see WithAuthentication and RequireStepUp
+	AuthTime    *jwt.NumericDate `json:"auth_time,omitempty"`
+	AuthMethods []string         `json:"amr,omitempty"` // RFC 8176 values, e.g. "pwd", "otp"
+
+	// STS session scope-down, see STSSession
+	SessionPolicy string            `json:"session_policy,omitempty"`
+	SessionTags   map[string]string `json:"session_tags,omitempty"`
+
+	// Extra carries custom claims set via WithClaim
+	Extra map[string]interface{} `json:"ext,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token for a user (RS256)
-func GenerateToken(userID int, username string, tenantID int, mfaAuth bool, signKey *rsa.PrivateKey) (string, error) {
-	claims := Claims{
+// Scopes returns the scope claim as a list
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScope reports whether the token was granted the scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateToken generates a new JWT token for a user.
+// The algorithm follows the key type (RS256, ES256/384/512 or EdDSA).
+func GenerateToken(userID int, username string, tenantID int, mfaAuth bool, signKey crypto.PrivateKey) (string, error) {
+	return signToken(newUserClaims(userID, username, tenantID, mfaAuth, DefaultTokenDuration), signKey, "", nil)
+}
+
+// GenerateTokenWithSession is GenerateToken linked to a server-side session (sid claim)
+func GenerateTokenWithSession(userID int, username string, tenantID int, mfaAuth bool, sessionID string, signKey crypto.PrivateKey) (string, error) {
+	claims := newUserClaims(userID, username, tenantID, mfaAuth, DefaultTokenDuration)
+	WithSessionID(sessionID)(&claims)
+	return signToken(claims, signKey, "", nil)
+}
+
+func newUserClaims(userID int, username string, tenantID int, mfaAuth bool, duration time.Duration) Claims {
+	return Claims{
 		UserID:           userID,
 		Username:         username,
 		TenantID:         tenantID,
 		MfaAuthenticated: mfaAuth,
+		AuthTime:         jwt.NewNumericDate(time.Now()), // Tokens are generated at login
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "arrow2012",
 			ID:        fmt.Sprintf("%d", time.Now().UnixNano()), // Unique JTI
 		},
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(signKey)
+// GenerateSTSToken generates a temporary JWT token for an assumed role
+func GenerateSTSToken(roleID int, roleName string, tenantID int, duration time.Duration, mfaAuth bool, signKey crypto.PrivateKey) (string, error) {
+	return GenerateSTSTokenWithSession(roleID, roleName, tenantID, duration, mfaAuth, nil, signKey)
 }
 
-// GenerateSTSToken generates a temporary JWT token for an assumed role (RS256)
-func GenerateSTSToken(roleID int, roleName string, tenantID int, duration time.Duration, mfaAuth bool, signKey *rsa.PrivateKey) (string, error) {
-	claims := Claims{
+// GenerateSTSTokenWithSession is GenerateSTSToken with an optional inline
+// session policy and session tags that scope down the assumed role.
+func GenerateSTSTokenWithSession(roleID int, roleName string, tenantID int, duration time.Duration, mfaAuth bool, session *STSSession, signKey crypto.PrivateKey) (string, error) {
+	claims := newSTSClaims(roleID, roleName, tenantID, mfaAuth)
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(duration))
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	if err := session.apply(&claims); err != nil {
+		return "", err
+	}
+	return signToken(claims, signKey, "", nil)
+}
+
+func newSTSClaims(roleID int, roleName string, tenantID int, mfaAuth bool) Claims {
+	return Claims{
 		RoleID:           roleID,
 		Username:         roleName,
 		TenantID:         tenantID,
 		MfaAuthenticated: mfaAuth,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "arrow2012-sts",
-			Subject:   "role-session",
+			Issuer:  "arrow2012-sts",
+			Subject: "role-session",
 		},
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	return token.SignedString(signKey)
 }
 
-// ParseToken parses and validates a JWT token using Public Key
-func ParseToken(tokenString string, verifyKey *rsa.PublicKey) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return verifyKey, nil
-	})
+// ParseToken parses and validates a JWT token using Public Key.
+// The token's alg must match the key type exactly.
+func ParseToken(tokenString string, verifyKey crypto.PublicKey) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, staticKeyfunc(verifyKey))
 
 	if err != nil {
 		return nil, err
@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -8,6 +12,7 @@ import (
 	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -82,6 +87,113 @@ func ParsePublicKeyFromPEM(pemStr string) (*rsa.PublicKey, error) {
 	}
 }
 
+// GenerateECDSAKeyPair generates a new ECDSA key pair (P-256 -> ES256, P-384 -> ES384, P-521 -> ES512)
+func GenerateECDSAKeyPair(curve elliptic.Curve) (*ecdsa.PrivateKey, *ecdsa.PublicKey, error) {
+	if _, err := ecdsaSigningMethod(curve); err != nil {
+		return nil, nil, err
+	}
+	privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return privKey, &privKey.PublicKey, nil
+}
+
+// GenerateEd25519KeyPair generates a new Ed25519 key pair (EdDSA)
+func GenerateEd25519KeyPair() (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, pub, nil
+}
+
+// MarshalPrivateKeyPEM encodes any supported private key as PKCS8 ("PRIVATE KEY")
+func MarshalPrivateKeyPEM(priv crypto.PrivateKey) (string, error) {
+	if _, err := SigningMethodForKey(priv); err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// MarshalPublicKeyPEM encodes any supported public key as PKIX ("PUBLIC KEY")
+func MarshalPublicKeyPEM(pub crypto.PublicKey) (string, error) {
+	if _, err := SigningMethodForKey(pub); err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// ParseSigningKeyFromPEM parses an RSA, ECDSA or Ed25519 private key.
+// Accepted blocks: "PRIVATE KEY" (PKCS8), "RSA PRIVATE KEY" (PKCS1), "EC PRIVATE KEY" (SEC1).
+func ParseSigningKeyFromPEM(pemStr string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing the key")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := SigningMethodForKey(key); err != nil {
+		return nil, err
+	}
+	return key.(crypto.Signer), nil
+}
+
+// ParseVerifyingKeyFromPEM parses an RSA, ECDSA or Ed25519 public key.
+// Accepted blocks: "PUBLIC KEY" (PKIX) and "RSA PUBLIC KEY" (PKIX as written by
+// PublicKeyToPEM, or PKCS1).
+func ParseVerifyingKeyFromPEM(pemStr string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing the key")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := SigningMethodForKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 // GenerateAccessKey generates a random Access Key (AK)
 // Format: NW + 18 characters random alphanumeric (approx)
 // Example: NWABC123...
@@ -0,0 +1,465 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKSPath is the well-known path where a KeySet is usually published
+const JWKSPath = "/.well-known/jwks.json"
+
+var (
+	ErrKeyNotFound    = errors.New("signing key not found")
+	ErrKeyRetired     = errors.New("signing key is retired")
+	ErrNoActiveKey    = errors.New("no active signing key")
+	ErrKeyIDMissing   = errors.New("token header has no kid")
+	ErrKeyIDDuplicate = errors.New("signing key with the same kid already exists")
+)
+
+// SigningKey is a key pair identified by a kid. The algorithm is implied by
+// the key type (RSA, ECDSA or Ed25519, see SigningMethodForKey) unless Alg is
+// set, e.g. PS256 for an RSA key. PrivateKey is nil for verify-only keys
+// (e.g. fetched from a remote JWKS).
+type SigningKey struct {
+	KID        string
+	Alg        string // JWT alg, empty for the one implied by the key type
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	CreatedAt  time.Time
+	Retired    bool
+}
+
+// NewSigningKey wraps a private key; the kid defaults to the RFC 7638 thumbprint
+func NewSigningKey(kid string, priv crypto.Signer) (*SigningKey, error) {
+	if priv == nil {
+		return nil, errors.New("private key is required")
+	}
+	if _, err := SigningMethodForKey(priv); err != nil {
+		return nil, err
+	}
+	if kid == "" {
+		var err error
+		if kid, err = KeyThumbprint(priv.Public()); err != nil {
+			return nil, err
+		}
+	}
+	return &SigningKey{
+		KID:        kid,
+		PrivateKey: priv,
+		PublicKey:  priv.Public(),
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// Algorithm returns the JWT alg of the key
+func (k *SigningKey) Algorithm() string {
+	method, err := signingMethodFor(k.PublicKey, k.Alg)
+	if err != nil {
+		return ""
+	}
+	return method.Alg()
+}
+
+// KeySet holds several signing keys to allow rotation without invalidating
+// outstanding tokens. New tokens are signed with the active key, verification
+// accepts any key that is not retired.
+//
+// Typical rotation: Add the new key, publish it via JWKS for a while, SetActive,
+// then Retire the old key once all tokens signed by it have expired.
+type KeySet struct {
+	mu     sync.RWMutex
+	keys   map[string]*SigningKey
+	order  []string // insertion order, for stable JWKS output
+	active string
+}
+
+// NewKeySet creates an empty KeySet
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*SigningKey)}
+}
+
+// Add adds a key to the set. The first key with a private key becomes active.
+func (ks *KeySet) Add(key *SigningKey) error {
+	if key == nil || key.KID == "" {
+		return errors.New("key and kid are required")
+	}
+	if key.PublicKey == nil && key.PrivateKey != nil {
+		key.PublicKey = key.PrivateKey.Public()
+	}
+	if key.PublicKey == nil {
+		return errors.New("public key is required")
+	}
+	if _, err := signingMethodFor(key.PublicKey, key.Alg); err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, ok := ks.keys[key.KID]; ok {
+		return ErrKeyIDDuplicate
+	}
+	ks.keys[key.KID] = key
+	ks.order = append(ks.order, key.KID)
+	if ks.active == "" && key.PrivateKey != nil && !key.Retired {
+		ks.active = key.KID
+	}
+	return nil
+}
+
+// SetActive selects the key used for signing new tokens
+func (ks *KeySet) SetActive(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if key.Retired {
+		return ErrKeyRetired
+	}
+	if key.PrivateKey == nil {
+		return errors.New("key has no private key")
+	}
+	ks.active = kid
+	return nil
+}
+
+// Retire stops accepting tokens signed by the key and removes it from JWKS.
+// The active key cannot be retired; activate another key first.
+func (ks *KeySet) Retire(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if ks.active == kid {
+		return errors.New("cannot retire the active key")
+	}
+	key.Retired = true
+	return nil
+}
+
+// Remove deletes a key from the set entirely
+func (ks *KeySet) Remove(kid string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	delete(ks.keys, kid)
+	for i, k := range ks.order {
+		if k == kid {
+			ks.order = append(ks.order[:i], ks.order[i+1:]...)
+			break
+		}
+	}
+	if ks.active == kid {
+		ks.active = ""
+	}
+}
+
+// Active returns the current signing key
+func (ks *KeySet) Active() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if ks.active == "" {
+		return nil, ErrNoActiveKey
+	}
+	return ks.keys[ks.active], nil
+}
+
+// Lookup returns a non-retired key by kid
+func (ks *KeySet) Lookup(kid string) (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if key.Retired {
+		return nil, ErrKeyRetired
+	}
+	return key, nil
+}
+
+// Sign signs the claims with the active key and sets the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key, err := ks.Active()
+	if err != nil {
+		return "", err
+	}
+
+	return signToken(claims, key.PrivateKey, key.Alg, map[string]interface{}{"kid": key.KID})
+}
+
+// Keyfunc resolves the verification key from the token's kid header and
+// checks that the token's alg matches that key.
+// It can be passed directly to jwt.Parse / jwt.ParseWithClaims.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrKeyIDMissing
+	}
+	key, err := ks.Lookup(kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTokenAlgorithm(token, key.PublicKey, key.Alg); err != nil {
+		return nil, err
+	}
+	return key.PublicKey, nil
+}
+
+// GenerateTokenWithKeySet is GenerateToken signed by the active key of the KeySet
+func GenerateTokenWithKeySet(userID int, username string, tenantID int, mfaAuth bool, ks *KeySet) (string, error) {
+	return ks.Sign(newUserClaims(userID, username, tenantID, mfaAuth, DefaultTokenDuration))
+}
+
+// ParseTokenWithKeySet parses and validates a JWT token against any non-retired key
+func ParseTokenWithKeySet(tokenString string, ks *KeySet) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, ks.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid token")
+}
+
+// JWK is a single JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+	Crv string `json:"crv,omitempty"` // EC, OKP
+	X   string `json:"x,omitempty"`   // EC, OKP
+	Y   string `json:"y,omitempty"`   // EC
+}
+
+// JWKS is a JSON Web Key Set document
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of all non-retired keys
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	doc := JWKS{Keys: make([]JWK, 0, len(ks.order))}
+	for _, kid := range ks.order {
+		key := ks.keys[kid]
+		if key.Retired {
+			continue
+		}
+		jwk, err := publicJWK(kid, key.PublicKey)
+		if err != nil {
+			continue
+		}
+		jwk.Alg = key.Algorithm()
+		doc.Keys = append(doc.Keys, jwk)
+	}
+	return doc
+}
+
+// JWKSHandler serves the KeySet as a JWKS document, e.g.
+//
+//	r.GET(auth.JWKSPath, ks.JWKSHandler())
+func (ks *KeySet) JWKSHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, ks.JWKS())
+	}
+}
+
+// ParseJWKS builds a verify-only KeySet from a JWKS document. Each key verifies
+// only tokens of its alg member (the one implied by the key type if absent).
+// Keys without a kid, with an unsupported kty or an alg not fitting the key are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc JWKS
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	ks := NewKeySet()
+	for _, k := range doc.Keys {
+		// Tokens select their key by kid, a key without one can never be used
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pub, err := publicKeyFromJWK(k)
+		if errors.Is(err, ErrUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: %w", k.Kid, err)
+		}
+		if _, err := signingMethodFor(pub, k.Alg); err != nil {
+			continue
+		}
+		if err := ks.Add(&SigningKey{KID: k.Kid, Alg: k.Alg, PublicKey: pub}); err != nil {
+			return nil, fmt.Errorf("jwk %q: %w", k.Kid, err)
+		}
+	}
+	return ks, nil
+}
+
+// FetchJWKS downloads a JWKS document (e.g. options.AuthOptions.JWKSURL) and
+// returns a verify-only KeySet. A nil client uses http.DefaultClient.
+func FetchJWKS(ctx context.Context, client *http.Client, url string) (*KeySet, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch jwks: unexpected status %d", resp.StatusCode)
+	}
+	// 1MB is far beyond any sane key set
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// KeyThumbprint computes the RFC 7638 JWK thumbprint, used as default kid
+func KeyThumbprint(pub crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK("", pub)
+	if err != nil {
+		return "", err
+	}
+
+	// Required members only, in lexicographic order, no whitespace
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Crv, jwk.X, jwk.Y)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func publicJWK(kid string, pub crypto.PublicKey) (JWK, error) {
+	method, err := SigningMethodForKey(pub)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk := JWK{Use: "sig", Alg: method.Alg(), Kid: kid}
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		// Coordinates are left-padded to the curve size (RFC 7518 6.2.1.2)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return JWK{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+	return jwk, nil
+}
+
+func publicKeyFromJWK(k JWK) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		return rsaPublicKeyFromJWK(k)
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid ec coordinates")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if _, err := pub.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid ec key: %w", err)
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: kty %s", ErrUnsupportedKey, k.Kty)
+	}
+}
+
+func rsaPublicKeyFromJWK(k JWK) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 {
+		return nil, errors.New("invalid rsa key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+)
+
+// DefaultPasswordHistoryDepth is the history kept by AppendPasswordHistory
+const DefaultPasswordHistoryDepth = 5
+
+// ClaimPasswordStatus is the "ext" claim carrying the PasswordStatus at login
+const ClaimPasswordStatus = "pwd_status"
+
+// PasswordStatus is the result of evaluating a password against the lifecycle policy
+type PasswordStatus string
+
+const (
+	PasswordStatusOK         PasswordStatus = "ok"
+	PasswordStatusWarn       PasswordStatus = "warn"        // Expires within the warning window
+	PasswordStatusExpired    PasswordStatus = "expired"     // Older than the max age
+	PasswordStatusMustChange PasswordStatus = "must-change" // Reset by an admin or first login
+)
+
+// Err returns the error to answer a request with, nil for ok and warn
+func (s PasswordStatus) Err() error {
+	switch s {
+	case PasswordStatusExpired:
+		return apperrors.ErrPasswordExpired
+	case PasswordStatusMustChange:
+		return apperrors.ErrPasswordMustChange
+	default:
+		return nil
+	}
+}
+
+// PasswordState is what the user store knows about a user's password
+type PasswordState struct {
+	ChangedAt  time.Time // Last change, zero if unknown
+	MustChange bool      // Set when an admin creates or resets the password
+	FirstLogin bool      // The user never logged in before
+}
+
+// PasswordEvaluation is the outcome of PasswordLifecycle.Evaluate
+type PasswordEvaluation struct {
+	Status    PasswordStatus `json:"status"`
+	ExpiresAt time.Time      `json:"expires_at"` // Zero when passwords do not expire
+}
+
+// PasswordLifecycle enforces password expiry, minimum age and history depth
+type PasswordLifecycle struct {
+	opts options.PasswordLifecycleOptions
+}
+
+// NewPasswordLifecycle creates a PasswordLifecycle
+func NewPasswordLifecycle(opts *options.PasswordLifecycleOptions) *PasswordLifecycle {
+	return &PasswordLifecycle{opts: *opts}
+}
+
+// Evaluate returns the status of the password at now.
+// A forced change takes precedence over expiry.
+func (l *PasswordLifecycle) Evaluate(state PasswordState, now time.Time) PasswordEvaluation {
+	var eval PasswordEvaluation
+	if l.opts.MaxAge > 0 && !state.ChangedAt.IsZero() {
+		eval.ExpiresAt = state.ChangedAt.Add(l.opts.MaxAge)
+	}
+
+	switch {
+	case state.MustChange || (l.opts.ForceChangeOnFirstLogin && state.FirstLogin):
+		eval.Status = PasswordStatusMustChange
+	case !eval.ExpiresAt.IsZero() && !now.Before(eval.ExpiresAt):
+		eval.Status = PasswordStatusExpired
+	case !eval.ExpiresAt.IsZero() && l.opts.WarnBefore > 0 && !now.Before(eval.ExpiresAt.Add(-l.opts.WarnBefore)):
+		eval.Status = PasswordStatusWarn
+	default:
+		eval.Status = PasswordStatusOK
+	}
+	return eval
+}
+
+// CanChange returns errors.ErrPasswordTooRecent while the password is younger than the
+// min age. Forced changes (must-change or expired) are always allowed.
+func (l *PasswordLifecycle) CanChange(state PasswordState, now time.Time) error {
+	if l.opts.MinAge <= 0 || state.ChangedAt.IsZero() {
+		return nil
+	}
+	if status := l.Evaluate(state, now).Status; status == PasswordStatusMustChange || status == PasswordStatusExpired {
+		return nil
+	}
+	if now.Sub(state.ChangedAt) < l.opts.MinAge {
+		return apperrors.ErrPasswordTooRecent
+	}
+	return nil
+}
+
+// CheckHistory returns errors.ErrPasswordReused if the new password matches one of
+// the last HistoryDepth hashes (oldest first, as built by AppendHistory)
+func (l *PasswordLifecycle) CheckHistory(history []string, newPassword string) error {
+	if l.opts.HistoryDepth <= 0 {
+		return nil
+	}
+	if len(history) > l.opts.HistoryDepth {
+		history = history[len(history)-l.opts.HistoryDepth:]
+	}
+	if CheckPasswordHistory(history, newPassword) {
+		return apperrors.ErrPasswordReused
+	}
+	return nil
+}
+
+// AppendHistory adds the new hash and keeps the last HistoryDepth hashes.
+// Without a history check the history is kept, at DefaultPasswordHistoryDepth or its current
+// length, so that enabling the check later does not start from scratch.
+func (l *PasswordLifecycle) AppendHistory(history []string, newHash string) []string {
+	if l.opts.HistoryDepth <= 0 {
+		return appendHistory(history, newHash, max(len(history), DefaultPasswordHistoryDepth))
+	}
+	return appendHistory(history, newHash, l.opts.HistoryDepth)
+}
+
+// WithPasswordStatus records the password status in the token, so that
+// middleware.RequirePasswordCurrent can restrict expired sessions
+func WithPasswordStatus(status PasswordStatus) IssueOption {
+	return WithClaim(ClaimPasswordStatus, string(status))
+}
+
+// PasswordStatusFunc evaluates the current password status of a user,
+// typically PasswordLifecycle.Evaluate on the state in the user store
+type PasswordStatusFunc func(ctx context.Context, userID int) (PasswordStatus, error)
+
+// PasswordStatusFromClaims returns the status recorded by WithPasswordStatus, ok if absent
+func PasswordStatusFromClaims(claims *Claims) PasswordStatus {
+	if claims != nil {
+		if s, ok := claims.Extra[ClaimPasswordStatus].(string); ok && s != "" {
+			return PasswordStatus(s)
+		}
+	}
+	return PasswordStatusOK
+}
+
+func appendHistory(history []string, newHash string, depth int) []string {
+	history = append(history, newHash)
+	if len(history) > depth {
+		history = history[len(history)-depth:]
+	}
+	return history
+}
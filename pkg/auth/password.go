@@ -7,19 +7,25 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes the password using bcrypt
+// HashPassword hashes the password using bcrypt.
+// Prefer a PasswordHasher, which supports argon2id and configurable costs.
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 10)
 	return string(bytes), err
 }
 
-// CheckPasswordHash compares a password with a hash
+// CheckPasswordHash compares a password with a bcrypt or argon2id hash
 func CheckPasswordHash(password, hash string) bool {
+	if isArgon2idHash(hash) {
+		ok, _ := (&Argon2idHasher{}).Verify(password, hash)
+		return ok
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
-// ValidatePassword enforces password complexity policy
+// ValidatePassword enforces the fixed default complexity policy.
+// Use PasswordPolicy for configurable rules and structured violations.
 func ValidatePassword(password string) error {
 	if len(password) < 8 {
 		return fmt.Errorf("password must be at least 8 characters long")
@@ -55,7 +61,8 @@ func ValidatePassword(password string) error {
 	return nil
 }
 
-// CheckPasswordHistory checks if the new password has been used recently (in last 5).
+// CheckPasswordHistory checks if the new password matches any hash of the history.
+// Use PasswordLifecycle.CheckHistory for a configurable depth.
 func CheckPasswordHistory(history []string, newPassword string) bool {
 	for _, oldHash := range history {
 		if CheckPasswordHash(newPassword, oldHash) {
@@ -65,13 +72,7 @@ func CheckPasswordHistory(history []string, newPassword string) bool {
 	return false
 }
 
-// AppendPasswordHistory adds new hash and keeps max 5
+// AppendPasswordHistory adds new hash and keeps the last DefaultPasswordHistoryDepth
 func AppendPasswordHistory(history []string, newHash string) []string {
-	// Add to end
-	history = append(history, newHash)
-	if len(history) > 5 {
-		// Keep last 5
-		history = history[len(history)-5:]
-	}
-	return history
+	return appendHistory(history, newHash, DefaultPasswordHistoryDepth)
 }
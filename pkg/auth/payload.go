@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+)
+
+const (
+	// HeaderNuwaContentSHA256 carries the hex SHA-256 of the body computed by the
+	// client, or UnsignedPayload. When set the body is not buffered for signing.
+	HeaderNuwaContentSHA256 = "X-Nuwa-Content-Sha256"
+
+	// UnsignedPayload replaces the payload hash when the body is not signed
+	UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// payloadHash returns the payload hash to sign. A declared X-Nuwa-Content-Sha256
+// is used as is; with verify the body is wrapped to check it while streaming.
+// Otherwise the body is hashed in memory.
+func payloadHash(req *http.Request, verify bool) (string, error) {
+	declared := req.Header.Get(HeaderNuwaContentSHA256)
+	switch {
+	case declared == "":
+		return bufferedPayloadHash(req)
+	case declared == UnsignedPayload:
+		return declared, nil
+	}
+
+	declared = strings.ToLower(declared)
+	if b, err := hex.DecodeString(declared); err != nil || len(b) != sha256.Size {
+		return "", apperrors.ErrContentHashInvalid
+	}
+	if verify {
+		req.Body = NewVerifyingReader(req.Body, declared)
+	}
+	return declared, nil
+}
+
+// bufferedPayloadHash hashes the body and replaces it with a re-readable copy
+func bufferedPayloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		hash := sha256.Sum256(nil)
+		return hex.EncodeToString(hash[:]), nil
+	}
+
+	bodyBytes, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+	}
+
+	hash := sha256.Sum256(bodyBytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// verifyingReader hashes the body as it is read and fails at EOF on mismatch
+type verifyingReader struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected string
+	checked  bool // EOF reached and hash compared
+	err      error
+}
+
+// NewVerifyingReader wraps body so that reading it to the end returns
+// errors.ErrContentHashInvalid instead of io.EOF when its SHA-256 differs from expectedHex.
+// Close reads what the caller left unread and fails the same way, so decoders that stop
+// after the first value (json.Decoder, gin binding) cannot skip the check; callers that act
+// on the body before Close should read it to the end. A nil body is treated as empty.
+func NewVerifyingReader(body io.ReadCloser, expectedHex string) io.ReadCloser {
+	if body == nil {
+		body = http.NoBody
+	}
+	return &verifyingReader{
+		body:     body,
+		hash:     sha256.New(),
+		expected: strings.ToLower(expectedHex),
+	}
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	if r.checked {
+		return 0, r.eof()
+	}
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		r.check()
+		return n, r.eof()
+	}
+	return n, err
+}
+
+// Close drains the unread rest of the body and checks the hash
+func (r *verifyingReader) Close() error {
+	if !r.checked {
+		if _, err := io.Copy(r.hash, r.body); err != nil {
+			r.body.Close()
+			return err
+		}
+		r.check()
+	}
+	if err := r.body.Close(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+func (r *verifyingReader) check() {
+	r.checked = true
+	if hex.EncodeToString(r.hash.Sum(nil)) != r.expected {
+		r.err = apperrors.ErrContentHashInvalid
+	}
+}
+
+func (r *verifyingReader) eof() error {
+	if r.err != nil {
+		return r.err
+	}
+	return io.EOF
+}
+
+// DrainVerified reads the body of a verified request with a declared
+// X-Nuwa-Content-Sha256 into memory, so that the check of the verifying reader
+// runs before the handler, and replaces the body with a re-readable copy.
+// Bodies over limit bytes fail with errors.ErrRequestTooLarge.
+// Requests without a declared hash (or with UNSIGNED-PAYLOAD) are left unchanged.
+func DrainVerified(req *http.Request, limit int64) error {
+	declared := req.Header.Get(HeaderNuwaContentSHA256)
+	if declared == "" || declared == UnsignedPayload || req.Body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, req.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return apperrors.ErrRequestTooLarge
+		}
+		return err
+	}
+	if err := req.Body.Close(); err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+)
+
+// Password policy violation codes, stable identifiers for translation on the client
+const (
+	ViolationTooShort       = "password.too_short" // params: min
+	ViolationTooLong        = "password.too_long"  // params: max
+	ViolationMissingUpper   = "password.missing_upper"
+	ViolationMissingLower   = "password.missing_lower"
+	ViolationMissingDigit   = "password.missing_digit"
+	ViolationMissingSpecial = "password.missing_special"
+	ViolationCharClasses    = "password.char_classes" // params: min
+	ViolationRepeated       = "password.repeated"     // params: max
+	ViolationUserInfo       = "password.user_info"
+	ViolationBlocklisted    = "password.blocklisted"
+	ViolationLowEntropy     = "password.low_entropy" // params: min
+	ViolationBreached       = "password.breached"
+)
+
+// PasswordViolation is a broken policy rule
+type PasswordViolation struct {
+	Code   string            `json:"code"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// PasswordPolicyError lists every violation of a password.
+// It is an errors.ErrPasswordPolicy whose violations are sent as data by response.Error.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		codes[i] = v.Code
+	}
+	return apperrors.ErrPasswordPolicy.Message() + ": " + strings.Join(codes, ", ")
+}
+
+func (e *PasswordPolicyError) HTTPStatus() int      { return apperrors.ErrPasswordPolicy.HTTPStatus() }
+func (e *PasswordPolicyError) BusinessCode() int    { return apperrors.ErrPasswordPolicy.BusinessCode() }
+func (e *PasswordPolicyError) Message() string      { return apperrors.ErrPasswordPolicy.Message() }
+func (e *PasswordPolicyError) Details() interface{} { return e.Violations }
+func (e *PasswordPolicyError) Unwrap() error        { return apperrors.ErrPasswordPolicy }
+
+// PasswordPolicy checks passwords against configurable complexity rules
+type PasswordPolicy struct {
+	opts      options.PasswordPolicyOptions
+	blocklist map[string]struct{}
+	breaches  BreachChecker
+}
+
+// NewPasswordPolicy creates a PasswordPolicy, reading opts.BlocklistFile if set
+func NewPasswordPolicy(opts *options.PasswordPolicyOptions) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{
+		opts:      *opts,
+		blocklist: make(map[string]struct{}, len(opts.Blocklist)),
+	}
+	for _, pw := range opts.Blocklist {
+		p.blocklist[strings.ToLower(pw)] = struct{}{}
+	}
+
+	if opts.BlocklistFile != "" {
+		f, err := os.Open(opts.BlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				p.blocklist[strings.ToLower(line)] = struct{}{}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// SetBreachChecker enables the breachThreshold rule
+func (p *PasswordPolicy) SetBreachChecker(checker BreachChecker) {
+	p.breaches = checker
+}
+
+// Check returns every rule the password breaks, nil if it is acceptable.
+// username and email may be empty. Breach lookup failures are ignored, use Validate to see them.
+func (p *PasswordPolicy) Check(password, username, email string) []PasswordViolation {
+	violations, _ := p.check(password, username, email)
+	return violations
+}
+
+// Validate returns a *PasswordPolicyError if the password breaks any rule,
+// or the error of the breach lookup
+func (p *PasswordPolicy) Validate(password, username, email string) error {
+	violations, err := p.check(password, username, email)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (p *PasswordPolicy) check(password, username, email string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+	add := func(code string, params map[string]string) {
+		violations = append(violations, PasswordViolation{Code: code, Params: params})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.opts.MinLength > 0 && length < p.opts.MinLength {
+		add(ViolationTooShort, map[string]string{"min": strconv.Itoa(p.opts.MinLength)})
+	}
+	if p.opts.MaxLength > 0 && length > p.opts.MaxLength {
+		add(ViolationTooLong, map[string]string{"max": strconv.Itoa(p.opts.MaxLength)})
+	}
+
+	upper, lower, digit, special := charClasses(password)
+	if p.opts.RequireUpper && !upper {
+		add(ViolationMissingUpper, nil)
+	}
+	if p.opts.RequireLower && !lower {
+		add(ViolationMissingLower, nil)
+	}
+	if p.opts.RequireDigit && !digit {
+		add(ViolationMissingDigit, nil)
+	}
+	if p.opts.RequireSpecial && !special {
+		add(ViolationMissingSpecial, nil)
+	}
+	if p.opts.MinCharClasses > 0 && countTrue(upper, lower, digit, special) < p.opts.MinCharClasses {
+		add(ViolationCharClasses, map[string]string{"min": strconv.Itoa(p.opts.MinCharClasses)})
+	}
+
+	if p.opts.MaxRepeated > 0 && longestRun(password) > p.opts.MaxRepeated {
+		add(ViolationRepeated, map[string]string{"max": strconv.Itoa(p.opts.MaxRepeated)})
+	}
+
+	lowered := strings.ToLower(password)
+	if p.opts.DisallowUserInfo && containsUserInfo(lowered, username, email) {
+		add(ViolationUserInfo, nil)
+	}
+	if _, ok := p.blocklist[lowered]; ok {
+		add(ViolationBlocklisted, nil)
+	}
+
+	if p.opts.MinEntropy > 0 && PasswordEntropy(password) < p.opts.MinEntropy {
+		add(ViolationLowEntropy, map[string]string{"min": strconv.FormatFloat(p.opts.MinEntropy, 'f', -1, 64)})
+	}
+
+	if p.opts.BreachThreshold > 0 && p.breaches != nil {
+		count, err := p.breaches.Occurrences(password)
+		if err != nil {
+			return violations, err
+		}
+		if count >= p.opts.BreachThreshold {
+			add(ViolationBreached, nil)
+		}
+	}
+
+	return violations, nil
+}
+
+// PasswordPolicies holds the default policy and per-tenant overrides
+type PasswordPolicies struct {
+	def      *PasswordPolicy
+	tenants  map[string]*PasswordPolicy
+	breaches *BreachFile
+}
+
+// NewPasswordPolicies creates the policies configured in opts.Policy and opts.TenantPolicies,
+// sharing the breach file opts.BreachFile
+func NewPasswordPolicies(opts *options.PasswordOptions) (*PasswordPolicies, error) {
+	def, err := NewPasswordPolicy(&opts.Policy)
+	if err != nil {
+		return nil, err
+	}
+	ps := &PasswordPolicies{
+		def:     def,
+		tenants: make(map[string]*PasswordPolicy, len(opts.TenantPolicies)),
+	}
+	for tenant, tenantOpts := range opts.TenantPolicies {
+		p, err := NewPasswordPolicy(&tenantOpts)
+		if err != nil {
+			return nil, err
+		}
+		ps.tenants[tenant] = p
+	}
+
+	if opts.BreachFile != "" {
+		ps.breaches, err = OpenBreachFile(opts.BreachFile)
+		if err != nil {
+			return nil, err
+		}
+		ps.def.SetBreachChecker(ps.breaches)
+		for _, p := range ps.tenants {
+			p.SetBreachChecker(ps.breaches)
+		}
+	}
+	return ps, nil
+}
+
+// Close closes the breach file
+func (ps *PasswordPolicies) Close() error {
+	if ps.breaches != nil {
+		return ps.breaches.Close()
+	}
+	return nil
+}
+
+// ForTenant returns the policy of the tenant (Principal.TenantID), or the default policy
+func (ps *PasswordPolicies) ForTenant(tenantID string) *PasswordPolicy {
+	if p, ok := ps.tenants[tenantID]; ok {
+		return p
+	}
+	return ps.def
+}
+
+// PasswordEntropy estimates the entropy in bits as length * log2(pool size),
+// the pool being the union of the character classes used
+func PasswordEntropy(password string) float64 {
+	upper, lower, digit, special := charClasses(password)
+	pool := 0
+	if upper {
+		pool += 26
+	}
+	if lower {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if special {
+		pool += 33
+	}
+	for _, r := range password {
+		if r > unicode.MaxASCII {
+			pool += 100 // Rough allowance for non-ASCII alphabets
+			break
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(utf8.RuneCountInString(password)) * math.Log2(float64(pool))
+}
+
+func charClasses(password string) (upper, lower, digit, special bool) {
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsNumber(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			special = true
+		}
+	}
+	return
+}
+
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// longestRun returns the length of the longest run of one repeated character
+func longestRun(s string) int {
+	longest, run := 0, 0
+	var prev rune = -1
+	for _, r := range s {
+		if r == prev {
+			run++
+		} else {
+			run = 1
+			prev = r
+		}
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// containsUserInfo reports whether the lower-cased password contains the
+// username or the email local part (ignoring parts shorter than 3 characters)
+func containsUserInfo(password, username, email string) bool {
+	local, _, _ := strings.Cut(email, "@")
+	for _, info := range []string{username, local} {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if utf8.RuneCountInString(info) >= 3 && strings.Contains(password, info) {
+			return true
+		}
+	}
+	return false
+}
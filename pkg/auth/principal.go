@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+const principalKey contextKey = "principal"
+
+// "ext" claims read into the Principal, for services keyed by string IDs
+// and for session and client tracking
+const (
+	ClaimTenant    = "tid"       // String tenant ID, when TenantID does not fit an int
+	ClaimSessionID = "sid"       // Server-side session
+	ClaimClientID  = "client_id" // OAuth2 client the token was issued to
+)
+
+// Principal is the authenticated caller of a request.
+// IDs are strings so that both int and UUID keyed services fit; empty means unknown.
+type Principal struct {
+	UserID      string    `json:"user_id,omitempty"`
+	Username    string    `json:"username,omitempty"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	RoleID      string    `json:"role_id,omitempty"` // Assumed role (STS sessions)
+	Scopes      []string  `json:"scopes,omitempty"`
+	MFA         bool      `json:"mfa"`
+	AuthMethods []string  `json:"auth_methods,omitempty"`
+	AuthTime    time.Time `json:"auth_time"` // Zero if unknown
+	SessionID   string    `json:"session_id,omitempty"`
+	ClientID    string    `json:"client_id,omitempty"`
+}
+
+// PrincipalFromClaims builds the principal carried by verified token claims.
+// The user ID falls back to the subject, the tenant ID to the ClaimTenant claim.
+func PrincipalFromClaims(claims *Claims) *Principal {
+	p := &Principal{
+		UserID:      formatID(claims.UserID),
+		Username:    claims.Username,
+		TenantID:    formatID(claims.TenantID),
+		RoleID:      formatID(claims.RoleID),
+		Scopes:      claims.Scopes(),
+		MFA:         claims.MfaAuthenticated,
+		AuthMethods: claims.AuthMethods,
+		SessionID:   stringClaim(claims, ClaimSessionID),
+		ClientID:    stringClaim(claims, ClaimClientID),
+	}
+	if p.UserID == "" && p.RoleID == "" {
+		p.UserID = claims.Subject
+	}
+	if p.TenantID == "" {
+		p.TenantID = stringClaim(claims, ClaimTenant)
+	}
+	if claims.AuthTime != nil {
+		p.AuthTime = claims.AuthTime.Time
+	}
+	return p
+}
+
+// HasScope reports whether the principal was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAuthMethod reports whether the principal authenticated with the method
+func (p *Principal) HasAuthMethod(method string) bool {
+	for _, m := range p.AuthMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrincipal returns a new context with the given principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext returns the principal from the context
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	v, ok := ctx.Value(principalKey).(*Principal)
+	return v, ok && v != nil
+}
+
+// updatePrincipal stores a modified copy of the context principal (or a new one)
+func updatePrincipal(ctx context.Context, update func(p *Principal)) context.Context {
+	var p Principal
+	if current, ok := PrincipalFromContext(ctx); ok {
+		p = *current
+	}
+	update(&p)
+	return WithPrincipal(ctx, &p)
+}
+
+// principalIntID reads a numeric ID of the context principal
+func principalIntID(ctx context.Context, id func(p *Principal) string) (int, bool) {
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.Atoi(id(p))
+	return v, err == nil
+}
+
+func formatID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+func stringClaim(claims *Claims, key string) string {
+	s, _ := claims.Extra[key].(string)
+	return s
+}
@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+	"github.com/google/uuid"
+)
+
+const (
+	refreshTokenPrefix  = "auth:refresh:token:"
+	refreshFamilyPrefix = "auth:refresh:family:"
+)
+
+// refreshRotateScript replaces the family (KEYS[1]) and records the new token (KEYS[2])
+// only if the presented token hash (ARGV[1]) is still the current one. A deleted family
+// is not recreated; a stale token deletes it. Returns 1, 0 (no family) or -1 (reuse).
+// ARGV: hash, new family, family ID, TTL in ms.
+const refreshRotateScript = `
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return 0
+end
+if cjson.decode(data)['current'] ~= ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return -1
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[4])
+redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[4])
+return 1`
+
+// TokenPair is the result of a login or refresh (OAuth 2.0 token response shape)
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // Access token lifetime in seconds
+}
+
+// refreshFamily is the state shared by all refresh tokens descending from one login
+type refreshFamily struct {
+	ID               string    `json:"id"`
+	UserID           int       `json:"user_id"`
+	Username         string    `json:"username"`
+	TenantID         int       `json:"tenant_id"`
+	MfaAuthenticated bool      `json:"mfa_authenticated"`
+	AuthMethods      []string  `json:"amr,omitempty"`
+	SessionID        string    `json:"sid,omitempty"`
+	Current          string    `json:"current"` // Hash of the only refresh token that may be used
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// RefreshManager issues access/refresh token pairs and rotates refresh tokens.
+//
+// Refresh tokens are opaque random strings; only their SHA-256 is stored.
+// Every use rotates the token. Presenting a token that was already rotated
+// is treated as theft and revokes the whole family (OAuth 2.1 BCP).
+// Rotation does not extend the family: it ends RefreshDuration after the login.
+type RefreshManager struct {
+	cache      cache.Cache
+	issuer     *TokenIssuer
+	sessions   *SessionManager
+	pwdStatus  PasswordStatusFunc
+	refreshTTL time.Duration
+}
+
+// NewRefreshManager creates a RefreshManager. Access tokens are issued by the
+// TokenIssuer (opts.TokenDuration), refresh tokens live for opts.RefreshDuration.
+// Families are rotated by Eval, so a HybridCache is bypassed for its Redis store.
+func NewRefreshManager(c cache.Cache, issuer *TokenIssuer, opts *options.AuthOptions) *RefreshManager {
+	m := &RefreshManager{
+		cache:      remoteCache(c),
+		issuer:     issuer,
+		refreshTTL: 30 * 24 * time.Hour,
+	}
+	if opts != nil && opts.RefreshDuration > 0 {
+		m.refreshTTL = opts.RefreshDuration
+	}
+	return m
+}
+
+// Issue starts a new token family for a freshly authenticated user
+func (m *RefreshManager) Issue(ctx context.Context, userID int, username string, tenantID int, mfaAuth bool) (*TokenPair, error) {
+	family := &refreshFamily{
+		ID:               uuid.NewString(),
+		UserID:           userID,
+		Username:         username,
+		TenantID:         tenantID,
+		MfaAuthenticated: mfaAuth,
+		CreatedAt:        time.Now(),
+	}
+	return m.issuePair(ctx, family)
+}
+
+// IssueWithMethods is Issue recording the authentication methods (amr) of the login
+func (m *RefreshManager) IssueWithMethods(ctx context.Context, userID int, username string, tenantID int, methods ...string) (*TokenPair, error) {
+	family := &refreshFamily{
+		ID:               uuid.NewString(),
+		UserID:           userID,
+		Username:         username,
+		TenantID:         tenantID,
+		MfaAuthenticated: isMultiFactor(methods),
+		AuthMethods:      methods,
+		CreatedAt:        time.Now(),
+	}
+	return m.issuePair(ctx, family)
+}
+
+// SetSessions enables IssueForSession. Refreshing a family whose session was
+// revoked or expired then fails and revokes the family.
+func (m *RefreshManager) SetSessions(sessions *SessionManager) {
+	m.sessions = sessions
+}
+
+// SetPasswordStatus evaluates the password status of the user each time a token pair
+// is issued, so that refreshed tokens carry the current pwd_status claim
+// (WithPasswordStatus): an expired password stays restricted and a changed one is released.
+func (m *RefreshManager) SetPasswordStatus(fn PasswordStatusFunc) {
+	m.pwdStatus = fn
+}
+
+// IssueForSession is IssueWithMethods for a login tracked by a server-side session:
+// all tokens of the family carry its sid, and the family ends with the session.
+func (m *RefreshManager) IssueForSession(ctx context.Context, sessionID string, userID int, username string, tenantID int, methods ...string) (*TokenPair, error) {
+	if m.sessions == nil {
+		return nil, fmt.Errorf("refresh: sessions are not set")
+	}
+	family := &refreshFamily{
+		ID:               uuid.NewString(),
+		UserID:           userID,
+		Username:         username,
+		TenantID:         tenantID,
+		MfaAuthenticated: isMultiFactor(methods),
+		AuthMethods:      methods,
+		SessionID:        sessionID,
+		CreatedAt:        time.Now(),
+	}
+	return m.issuePair(ctx, family)
+}
+
+// Refresh exchanges a refresh token for a new token pair.
+// Returns errors.ErrRefreshInvalid for unknown/expired tokens and
+// errors.ErrRefreshReused when a rotated token is replayed (the family is revoked).
+// Of concurrent refreshes with the same token one wins, the others count as reuse.
+func (m *RefreshManager) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	hash := hashRefreshToken(refreshToken)
+
+	familyID, err := m.cache.Get(ctx, refreshTokenPrefix+hash)
+	if err != nil {
+		if cache.IsMiss(err) {
+			return nil, apperrors.ErrRefreshInvalid
+		}
+		return nil, err
+	}
+
+	family, err := m.getFamily(ctx, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if family == nil {
+		// Family revoked or expired
+		return nil, apperrors.ErrRefreshInvalid
+	}
+
+	if family.Current != hash {
+		// An older token of the family: someone kept a copy
+		if err := m.RevokeFamily(ctx, familyID); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.ErrRefreshReused
+	}
+
+	// Absolute lifetime, counted from the login
+	remaining := time.Until(family.CreatedAt.Add(m.refreshTTL))
+	if remaining < time.Millisecond {
+		if err := m.RevokeFamily(ctx, familyID); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.ErrRefreshInvalid
+	}
+
+	if family.SessionID != "" && m.sessions != nil {
+		if _, err := m.sessions.Touch(ctx, family.SessionID, ""); err != nil {
+			if err == apperrors.ErrSessionInvalid {
+				if err := m.RevokeFamily(ctx, familyID); err != nil {
+					return nil, err
+				}
+				return nil, apperrors.ErrRefreshInvalid
+			}
+			return nil, err
+		}
+	}
+
+	return m.rotate(ctx, family, hash, remaining)
+}
+
+// Revoke revokes the family the refresh token belongs to (logout)
+func (m *RefreshManager) Revoke(ctx context.Context, refreshToken string) error {
+	familyID, err := m.cache.Get(ctx, refreshTokenPrefix+hashRefreshToken(refreshToken))
+	if err != nil {
+		if cache.IsMiss(err) {
+			return nil
+		}
+		return err
+	}
+	return m.RevokeFamily(ctx, familyID)
+}
+
+// RevokeFamily invalidates every refresh token of the family.
+// Token records expire on their own; without the family they are unusable.
+func (m *RefreshManager) RevokeFamily(ctx context.Context, familyID string) error {
+	return m.cache.Del(ctx, refreshFamilyPrefix+familyID)
+}
+
+// issuePair stores a new family and returns its first token pair
+func (m *RefreshManager) issuePair(ctx context.Context, family *refreshFamily) (*TokenPair, error) {
+	opts, err := m.issueOptions(ctx, family)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	hash := hashRefreshToken(refreshToken)
+
+	if err := m.cache.Set(ctx, refreshTokenPrefix+hash, family.ID, m.refreshTTL); err != nil {
+		return nil, err
+	}
+
+	family.Current = hash
+	data, err := json.Marshal(family)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.cache.Set(ctx, refreshFamilyPrefix+family.ID, string(data), m.refreshTTL); err != nil {
+		return nil, err
+	}
+	return m.tokenPair(family, refreshToken, opts)
+}
+
+// rotate replaces the current token hash of the family, if it still is the current one
+func (m *RefreshManager) rotate(ctx context.Context, family *refreshFamily, hash string, ttl time.Duration) (*TokenPair, error) {
+	opts, err := m.issueOptions(ctx, family)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	newHash := hashRefreshToken(refreshToken)
+
+	family.Current = newHash
+	data, err := json.Marshal(family)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.cache.Eval(ctx, refreshRotateScript,
+		[]string{refreshFamilyPrefix + family.ID, refreshTokenPrefix + newHash},
+		hash, string(data), family.ID, ttl.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	switch n, _ := res.(int64); n {
+	case 1:
+		return m.tokenPair(family, refreshToken, opts)
+	case -1:
+		return nil, apperrors.ErrRefreshReused
+	default:
+		return nil, apperrors.ErrRefreshInvalid
+	}
+}
+
+// issueOptions are the claims of the access tokens of the family
+func (m *RefreshManager) issueOptions(ctx context.Context, family *refreshFamily) ([]IssueOption, error) {
+	// The family starts at login: its creation is the authentication time
+	opts := []IssueOption{WithAuthentication(family.CreatedAt, family.AuthMethods...)}
+	if family.SessionID != "" {
+		opts = append(opts, WithSessionID(family.SessionID))
+	}
+	if m.pwdStatus != nil {
+		status, err := m.pwdStatus(ctx, family.UserID)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithPasswordStatus(status))
+	}
+	return opts, nil
+}
+
+// tokenPair issues the access token going with refreshToken
+func (m *RefreshManager) tokenPair(family *refreshFamily, refreshToken string, opts []IssueOption) (*TokenPair, error) {
+	accessToken, claims, err := m.issuer.IssueUserToken(family.UserID, family.Username, family.TenantID, family.MfaAuthenticated, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    claims.ExpiresAt.Unix() - claims.IssuedAt.Unix(),
+	}, nil
+}
+
+// getFamily returns nil when the family does not exist
+func (m *RefreshManager) getFamily(ctx context.Context, familyID string) (*refreshFamily, error) {
+	data, err := m.cache.Get(ctx, refreshFamilyPrefix+familyID)
+	if err != nil {
+		if cache.IsMiss(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var family refreshFamily
+	if err := json.Unmarshal([]byte(data), &family); err != nil {
+		return nil, fmt.Errorf("decode refresh family: %w", err)
+	}
+	return &family, nil
+}
+
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
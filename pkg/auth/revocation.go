@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// RevocationLocalTTL bounds how long a pod may keep serving a stale
+	// "not revoked" answer from L1 when the invalidation broadcast is missed.
+	RevocationLocalTTL = 10 * time.Second
+
+	revokedJTIPrefix  = "auth:revoked:jti:"
+	revokedUserPrefix = "auth:revoked:user:"
+)
+
+// revokeUserScript raises the user watermark (KEYS[1]) to ARGV[1] unless it is
+// already later, refreshes its TTL (ARGV[2] ms) and returns the watermark
+const revokeUserScript = `
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local watermark = math.max(current, tonumber(ARGV[1]))
+redis.call('SET', KEYS[1], watermark, 'PX', ARGV[2])
+return watermark`
+
+// RevocationStore keeps a deny list of token IDs (JTI) and a per-user
+// "tokens issued before T are invalid" watermark.
+//
+// When backed by a *cache.HybridCache, lookups are answered from L1 (including
+// negative answers) and revocations are broadcast through the L1 invalidator,
+// so the common "not revoked" case does not hit Redis on every request.
+type RevocationStore struct {
+	remote           cache.Cache
+	local            cache.Cache // optional
+	rdb              *redis.Client
+	maxTokenLifetime time.Duration
+}
+
+// NewRevocationStore creates a RevocationStore.
+// maxTokenLifetime must cover the longest-lived token, it is used as the TTL of user watermarks.
+func NewRevocationStore(c cache.Cache, maxTokenLifetime time.Duration) *RevocationStore {
+	if maxTokenLifetime <= 0 {
+		maxTokenLifetime = 24 * time.Hour
+	}
+	s := &RevocationStore{remote: c, maxTokenLifetime: maxTokenLifetime}
+	if h, ok := c.(*cache.HybridCache); ok {
+		s.remote = h.Remote()
+		s.local = h.Local()
+		s.rdb = h.GetRedisClient()
+	}
+	return s
+}
+
+// RevokeJTI denies a single token until it expires
+func (s *RevocationStore) RevokeJTI(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return fmt.Errorf("jti is required")
+	}
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		// Already expired, nothing to deny
+		return nil
+	}
+	return s.set(ctx, revokedJTIPrefix+jti, "1", ttl)
+}
+
+// RevokeToken denies the token described by claims (logout)
+func (s *RevocationStore) RevokeToken(ctx context.Context, claims *Claims) error {
+	if claims.ExpiresAt == nil {
+		return s.RevokeJTI(ctx, claims.ID, time.Now().Add(s.maxTokenLifetime))
+	}
+	return s.RevokeJTI(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RevokeAllForUser invalidates every token of the user issued before the given time.
+// iat has second precision: tokens issued within the second of before stay valid, so
+// that a login right after a revoke-all works. An earlier before never lowers the
+// watermark of a previous call. userID is Principal.UserID, e.g. strconv.Itoa of an int ID.
+// It needs cache.Eval (Redis).
+func (s *RevocationStore) RevokeAllForUser(ctx context.Context, userID string, before time.Time) error {
+	if userID == "" {
+		return fmt.Errorf("user id is required")
+	}
+	key := revokedUserPrefix + userID
+	res, err := s.remote.Eval(ctx, revokeUserScript, []string{key}, before.Unix(), s.maxTokenLifetime.Milliseconds())
+	if err != nil {
+		return err
+	}
+	watermark, ok := res.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected revocation watermark: %v", res)
+	}
+	s.setLocal(ctx, key, strconv.FormatInt(watermark, 10), s.maxTokenLifetime)
+	return nil
+}
+
+// IsRevoked reports whether the token was revoked individually or by a user watermark
+func (s *RevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	if claims.ID != "" {
+		v, err := s.get(ctx, revokedJTIPrefix+claims.ID)
+		if err != nil {
+			return false, err
+		}
+		if v != "" {
+			return true, nil
+		}
+	}
+
+	if userID := PrincipalFromClaims(claims).UserID; userID != "" && claims.IssuedAt != nil {
+		v, err := s.get(ctx, revokedUserPrefix+userID)
+		if err != nil {
+			return false, err
+		}
+		if v != "" {
+			watermark, err := strconv.ParseInt(v, 10, 64)
+			if err == nil && claims.IssuedAt.Unix() < watermark {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// ParseTokenWithRevocation is ParseToken that additionally rejects revoked tokens.
+// It fails closed: if the store cannot be reached the token is rejected.
+func ParseTokenWithRevocation(ctx context.Context, tokenString string, verifyKey crypto.PublicKey, store *RevocationStore) (*Claims, error) {
+	claims, err := ParseToken(tokenString, verifyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := store.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, fmt.Errorf("check revocation: %w", err)
+	}
+	if revoked {
+		return nil, apperrors.ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+func (s *RevocationStore) set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if err := s.remote.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	s.setLocal(ctx, key, value, ttl)
+	return nil
+}
+
+// setLocal updates L1 after a remote write and drops stale entries on other pods
+func (s *RevocationStore) setLocal(ctx context.Context, key, value string, ttl time.Duration) {
+	if s.local != nil {
+		s.local.Set(ctx, key, value, min(ttl, RevocationLocalTTL))
+		_ = cache.PublishInvalidation(ctx, s.rdb, key)
+	}
+}
+
+// get returns "" when the key does not exist
+func (s *RevocationStore) get(ctx context.Context, key string) (string, error) {
+	if s.local != nil {
+		if v, err := s.local.Get(ctx, key); err == nil {
+			if v == "0" {
+				return "", nil
+			}
+			return v, nil
+		}
+	}
+
+	v, err := s.remote.Get(ctx, key)
+	if err != nil && !cache.IsMiss(err) {
+		return "", err
+	}
+
+	if s.local != nil {
+		// Cache negative answers too, they are the common case
+		cached := v
+		if cached == "" {
+			cached = "0"
+		}
+		s.local.Set(ctx, key, cached, RevocationLocalTTL)
+	}
+	return v, nil
+}
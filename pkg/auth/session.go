@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+	"github.com/google/uuid"
+)
+
+const (
+	sessionPrefix     = "auth:session:"
+	sessionUserPrefix = "auth:session:user:"
+)
+
+// sessionUpdateScript overwrites a session only if it still exists,
+// so that a concurrent Touch cannot resurrect a revoked session
+const sessionUpdateScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1`
+
+// setCache is a cache with the Redis set commands of the per-user index
+type setCache interface {
+	cache.Cache
+	SMembers(ctx context.Context, key string) ([]string, error)
+	SRem(ctx context.Context, key string, members ...interface{}) error
+	Expire(ctx context.Context, key string, expiration time.Duration) error
+}
+
+// Session is a login of a user on a device
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username,omitempty"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	Device     string    `json:"device,omitempty"` // Display name, e.g. "Chrome on macOS"
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"` // Absolute expiry
+}
+
+// SessionManager keeps server-side sessions in the cache, with a per-user index
+// for "where you're logged in" pages and revoke-all.
+//
+// A session expires after IdleTimeout without Touch, and at the latest
+// AbsoluteTimeout after its creation. Tokens link to their session through the
+// sid claim (WithSessionID, GenerateTokenWithSession) and are rejected by a
+// TokenVerifier using WithSessions once the session is gone. Refresh token
+// families started by RefreshManager.IssueForSession end with their session, so
+// Revoke and RevokeAll also stop refreshes.
+type SessionManager struct {
+	opts  options.SessionOptions
+	cache setCache
+}
+
+// NewSessionManager creates a SessionManager. The per-user index needs Redis sets
+// (cache.RedisCache); other caches are rejected. A HybridCache is bypassed for its
+// Redis store, so that revocations and activity are seen by every pod at once.
+func NewSessionManager(opts *options.SessionOptions, c cache.Cache) (*SessionManager, error) {
+	sc, ok := remoteCache(c).(setCache)
+	if !ok {
+		return nil, fmt.Errorf("session: cache %T does not support sets", remoteCache(c))
+	}
+	return &SessionManager{opts: *opts, cache: sc}, nil
+}
+
+// Create starts a session for s.UserID with the device details of s,
+// and returns it with its ID and times set
+func (m *SessionManager) Create(ctx context.Context, s Session) (*Session, error) {
+	now := time.Now()
+	s.ID = uuid.NewString()
+	s.CreatedAt = now
+	s.LastSeenAt = now
+	s.ExpiresAt = now.Add(m.opts.AbsoluteTimeout)
+
+	if err := m.save(ctx, &s, now, false); err != nil {
+		return nil, err
+	}
+	indexKey := sessionUserPrefix + s.UserID
+	if err := m.cache.SAdd(ctx, indexKey, s.ID); err != nil {
+		return nil, err
+	}
+	// The index outlives every session it lists
+	if err := m.cache.Expire(ctx, indexKey, m.opts.AbsoluteTimeout); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Get returns the session, errors.ErrSessionInvalid if it expired or was revoked
+func (m *SessionManager) Get(ctx context.Context, sessionID string) (*Session, error) {
+	data, err := m.cache.Get(ctx, sessionPrefix+sessionID)
+	if err != nil {
+		if cache.IsMiss(err) {
+			return nil, apperrors.ErrSessionInvalid
+		}
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Touch records activity and slides the idle expiration.
+// Writes happen at most once per TouchInterval; ip is recorded if not empty.
+func (m *SessionManager) Touch(ctx context.Context, sessionID, ip string) (*Session, error) {
+	s, err := m.Get(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.Sub(s.LastSeenAt) < m.opts.TouchInterval && (ip == "" || ip == s.IP) {
+		return s, nil
+	}
+
+	s.LastSeenAt = now
+	if ip != "" {
+		s.IP = ip
+	}
+	if err := m.save(ctx, s, now, true); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns the live sessions of the user, most recently seen first.
+// Expired sessions are pruned from the index.
+func (m *SessionManager) List(ctx context.Context, userID string) ([]Session, error) {
+	indexKey := sessionUserPrefix + userID
+	ids, err := m.cache.SMembers(ctx, indexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(ids))
+	for _, id := range ids {
+		s, err := m.Get(ctx, id)
+		if err == apperrors.ErrSessionInvalid {
+			if err := m.cache.SRem(ctx, indexKey, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// Revoke ends a session (logout). Revoking an unknown session is not an error.
+func (m *SessionManager) Revoke(ctx context.Context, sessionID string) error {
+	s, err := m.Get(ctx, sessionID)
+	if err == apperrors.ErrSessionInvalid {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.cache.Del(ctx, sessionPrefix+sessionID); err != nil {
+		return err
+	}
+	return m.cache.SRem(ctx, sessionUserPrefix+s.UserID, sessionID)
+}
+
+// RevokeAll ends every session of the user except the listed ones
+// (e.g. the current session for "log out other devices")
+func (m *SessionManager) RevokeAll(ctx context.Context, userID string, except ...string) error {
+	indexKey := sessionUserPrefix + userID
+	ids, err := m.cache.SMembers(ctx, indexKey)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(except))
+	for _, id := range except {
+		keep[id] = true
+	}
+	for _, id := range ids {
+		if keep[id] {
+			continue
+		}
+		if err := m.cache.Del(ctx, sessionPrefix+id); err != nil {
+			return err
+		}
+		if err := m.cache.SRem(ctx, indexKey, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save stores the session until the idle or the absolute timeout, whichever comes first
+func (m *SessionManager) save(ctx context.Context, s *Session, now time.Time, update bool) error {
+	ttl := min(m.opts.IdleTimeout, s.ExpiresAt.Sub(now))
+	if ttl <= 0 {
+		return apperrors.ErrSessionInvalid
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if !update {
+		return m.cache.Set(ctx, sessionPrefix+s.ID, string(data), ttl)
+	}
+
+	res, err := m.cache.Eval(ctx, sessionUpdateScript, []string{sessionPrefix + s.ID}, string(data), ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+	if updated, _ := res.(int64); updated == 0 {
+		return apperrors.ErrSessionInvalid
+	}
+	return nil
+}
+
+// WithSessionID links the token to a server-side session (sid claim)
+func WithSessionID(sessionID string) IssueOption {
+	return WithClaim(ClaimSessionID, sessionID)
+}
+
+// SessionIDFromClaims returns the session linked by WithSessionID, empty if none
+func SessionIDFromClaims(claims *Claims) string {
+	return stringClaim(claims, ClaimSessionID)
+}
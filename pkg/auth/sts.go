@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+)
+
+// Session policy and tag limits, mirroring AWS AssumeRole
+const (
+	MaxSessionPolicySize  = 2048
+	MaxSessionTags        = 50
+	MaxSessionTagKeyLen   = 128
+	MaxSessionTagValueLen = 256
+)
+
+var ErrSessionPolicyInvalid = errors.New("session policy must be a JSON object")
+
+// STSSession scopes down an assumed-role session.
+// The effective permissions are the intersection of the role's policies and
+// the session Policy; Tags are exposed to policies as session attributes.
+type STSSession struct {
+	Policy string            // Inline JSON policy document
+	Tags   map[string]string // Session tags
+}
+
+// Validate checks the session against the size limits
+func (s *STSSession) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.Policy != "" {
+		if len(s.Policy) > MaxSessionPolicySize {
+			return fmt.Errorf("session policy exceeds %d bytes", MaxSessionPolicySize)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(s.Policy), &doc); err != nil {
+			return ErrSessionPolicyInvalid
+		}
+	}
+	if len(s.Tags) > MaxSessionTags {
+		return fmt.Errorf("session tags exceed %d entries", MaxSessionTags)
+	}
+	for k, v := range s.Tags {
+		if k == "" || utf8.RuneCountInString(k) > MaxSessionTagKeyLen {
+			return fmt.Errorf("session tag key %q must be 1-%d characters", k, MaxSessionTagKeyLen)
+		}
+		if utf8.RuneCountInString(v) > MaxSessionTagValueLen {
+			return fmt.Errorf("session tag %q value exceeds %d characters", k, MaxSessionTagValueLen)
+		}
+	}
+	return nil
+}
+
+// apply validates the session and copies it into the claims
+func (s *STSSession) apply(claims *Claims) error {
+	if s == nil {
+		return nil
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	claims.SessionPolicy = s.Policy
+	if len(s.Tags) > 0 {
+		claims.SessionTags = make(map[string]string, len(s.Tags))
+		for k, v := range s.Tags {
+			claims.SessionTags[k] = v
+		}
+	}
+	return nil
+}
+
+// IssueSTSToken is the TokenIssuer counterpart of GenerateSTSTokenWithSession
+func (i *TokenIssuer) IssueSTSToken(roleID int, roleName string, tenantID int, duration time.Duration, mfaAuth bool, session *STSSession, opts ...IssueOption) (string, *Claims, error) {
+	claims := newSTSClaims(roleID, roleName, tenantID, mfaAuth)
+	if err := session.apply(&claims); err != nil {
+		return "", nil, err
+	}
+	return i.Issue(claims, append([]IssueOption{WithDuration(duration)}, opts...)...)
+}
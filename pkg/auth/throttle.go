@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+)
+
+const throttlePrefix = "auth:throttle:"
+
+// Scopes failed logins are counted in
+const (
+	ThrottleScopeAccount = "account"
+	ThrottleScopeIP      = "ip"
+	ThrottleScopePair    = "pair" // Account from one IP
+)
+
+// throttleFailureScript counts a failure (KEYS: failures, delay, lock, lockouts) and
+// starts a lockout or a delay. ARGV: window, delayAfter, lockAfter, baseDelay, maxDelay,
+// lockout, maxLockout (durations in ms, 0 thresholds disable).
+const throttleFailureScript = `
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+local delayAfter, lockAfter = tonumber(ARGV[2]), tonumber(ARGV[3])
+if lockAfter > 0 and n >= lockAfter then
+	local l = redis.call('INCR', KEYS[4])
+	redis.call('PEXPIRE', KEYS[4], ARGV[7])
+	local d = math.min(tonumber(ARGV[6]) * 2 ^ math.min(l - 1, 30), tonumber(ARGV[7]))
+	redis.call('SET', KEYS[3], '1', 'PX', math.floor(d))
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return n
+end
+if delayAfter > 0 and n >= delayAfter then
+	local d = math.min(tonumber(ARGV[4]) * 2 ^ math.min(n - delayAfter, 30), tonumber(ARGV[5]))
+	redis.call('SET', KEYS[2], '1', 'PX', math.floor(d))
+end
+return n`
+
+// throttleStatusScript returns failures, delay and lock PTTL of each (failures, delay, lock) key triple
+const throttleStatusScript = `
+local res = {}
+for i = 1, #KEYS, 3 do
+	table.insert(res, tonumber(redis.call('GET', KEYS[i]) or '0'))
+	table.insert(res, redis.call('PTTL', KEYS[i + 1]))
+	table.insert(res, redis.call('PTTL', KEYS[i + 2]))
+end
+return res`
+
+// ThrottleScopeStatus is the state of one scope of a login
+type ThrottleScopeStatus struct {
+	Scope      string `json:"scope"`
+	Failures   int64  `json:"failures"` // In the current window, reset by a lockout
+	Locked     bool   `json:"locked"`
+	RetryAfter int64  `json:"retry_after"` // Seconds of lockout or delay left, 0 if none
+}
+
+// LoginThrottle protects logins against brute force and credential stuffing.
+//
+// Call Check before verifying the password, then Failure or Success.
+// After DelayAfter failures of a scope each further attempt must wait a delay
+// doubling from BaseDelay, after LockAfter failures the scope is locked out
+// for LockoutDuration, doubling with each lockout until MaxLockoutDuration.
+// Success resets the account and pair scopes but not the IP, which could
+// otherwise be reset by an attacker owning one account.
+type LoginThrottle struct {
+	opts  options.LoginThrottleOptions
+	cache cache.Cache
+}
+
+// NewLoginThrottle creates a LoginThrottle. It needs cache.Eval (Redis).
+func NewLoginThrottle(opts *options.LoginThrottleOptions, c cache.Cache) *LoginThrottle {
+	return &LoginThrottle{opts: *opts, cache: c}
+}
+
+// Check returns errors.ErrTooManyRequests while account, ip or their pair is
+// delayed or locked out, with {"retry_after": seconds, "scope", "locked"} as details.
+// Empty account or ip skip their scopes.
+func (t *LoginThrottle) Check(ctx context.Context, account, ip string) error {
+	statuses, err := t.Status(ctx, account, ip)
+	if err != nil {
+		return err
+	}
+
+	var worst *ThrottleScopeStatus
+	for i := range statuses {
+		if s := &statuses[i]; s.RetryAfter > 0 && (worst == nil || s.RetryAfter > worst.RetryAfter) {
+			worst = s
+		}
+	}
+	if worst == nil {
+		return nil
+	}
+	return apperrors.WithDetails(apperrors.ErrTooManyRequests, map[string]interface{}{
+		"retry_after": worst.RetryAfter,
+		"scope":       worst.Scope,
+		"locked":      worst.Locked,
+	})
+}
+
+// Failure records a failed login
+func (t *LoginThrottle) Failure(ctx context.Context, account, ip string) error {
+	for _, s := range t.scopes(account, ip) {
+		_, err := t.cache.Eval(ctx, throttleFailureScript,
+			[]string{s.key("fail"), s.key("delay"), s.key("lock"), s.key("lockouts")},
+			t.opts.Window.Milliseconds(), s.limit.DelayAfter, s.limit.LockAfter,
+			t.opts.BaseDelay.Milliseconds(), t.opts.MaxDelay.Milliseconds(),
+			t.opts.LockoutDuration.Milliseconds(), t.opts.MaxLockoutDuration.Milliseconds())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Success resets the account and pair failures after a successful login
+func (t *LoginThrottle) Success(ctx context.Context, account, ip string) error {
+	for _, s := range t.scopes(account, ip) {
+		if s.name == ThrottleScopeIP {
+			continue
+		}
+		if err := t.reset(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unlock clears failures, delays and lockouts of the account, the ip and their pair
+// (admin API). Empty account or ip skip their scopes.
+func (t *LoginThrottle) Unlock(ctx context.Context, account, ip string) error {
+	for _, s := range t.scopes(account, ip) {
+		if err := t.reset(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status returns the state of each scope of account and ip (admin API)
+func (t *LoginThrottle) Status(ctx context.Context, account, ip string) ([]ThrottleScopeStatus, error) {
+	scopes := t.scopes(account, ip)
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, 3*len(scopes))
+	for _, s := range scopes {
+		keys = append(keys, s.key("fail"), s.key("delay"), s.key("lock"))
+	}
+
+	res, err := t.cache.Eval(ctx, throttleStatusScript, keys)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := res.([]interface{})
+	if !ok || len(values) != len(keys) {
+		return nil, fmt.Errorf("unexpected throttle status result: %v", res)
+	}
+
+	statuses := make([]ThrottleScopeStatus, len(scopes))
+	for i, s := range scopes {
+		failures, _ := values[3*i].(int64)
+		delay, _ := values[3*i+1].(int64)
+		lock, _ := values[3*i+2].(int64)
+
+		statuses[i] = ThrottleScopeStatus{Scope: s.name, Failures: failures}
+		switch {
+		case lock > 0:
+			statuses[i].Locked = true
+			statuses[i].RetryAfter = ceilSeconds(lock)
+		case delay > 0:
+			statuses[i].RetryAfter = ceilSeconds(delay)
+		}
+	}
+	return statuses, nil
+}
+
+// ceilSeconds rounds milliseconds up, so clients never retry too early
+func ceilSeconds(ms int64) int64 {
+	return (ms + 999) / 1000
+}
+
+func (t *LoginThrottle) reset(ctx context.Context, s throttleScope) error {
+	for _, kind := range []string{"fail", "delay", "lock", "lockouts"} {
+		if err := t.cache.Del(ctx, s.key(kind)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type throttleScope struct {
+	name  string
+	id    string
+	limit options.ThrottleLimit
+}
+
+// key is auth:throttle:<kind>:<scope>:<id>
+func (s throttleScope) key(kind string) string {
+	return throttlePrefix + kind + ":" + s.name + ":" + s.id
+}
+
+func (t *LoginThrottle) scopes(account, ip string) []throttleScope {
+	var scopes []throttleScope
+	if account != "" {
+		scopes = append(scopes, throttleScope{ThrottleScopeAccount, account, t.opts.Account})
+	}
+	if ip != "" {
+		scopes = append(scopes, throttleScope{ThrottleScopeIP, ip, t.opts.IP})
+	}
+	if account != "" && ip != "" {
+		scopes = append(scopes, throttleScope{ThrottleScopePair, account + "|" + ip, t.opts.Pair})
+	}
+	return scopes
+}
@@ -2,13 +2,36 @@ package auth
 
 import (
 	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
 	"image/png"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 )
 
+const totpLastStepPrefix = "auth:totp:step:"
+
+// maxTOTPSkew bounds the periods accepted around the current one, as TOTPOptions.Validate does
+const maxTOTPSkew = 5
+
+// totpUseStepScript records a time step if it is newer than the last accepted one
+const totpUseStepScript = `
+local last = tonumber(redis.call('GET', KEYS[1]) or '-1')
+if tonumber(ARGV[1]) <= last then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1`
+
 // GenerateTOTPKey generates a new TOTP key for a user.
+// Use TOTP for configurable parameters and replay protection.
 func GenerateTOTPKey(accountName string) (*otp.Key, error) {
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      "Nuwa IAM",
@@ -21,6 +44,7 @@ func GenerateTOTPKey(accountName string) (*otp.Key, error) {
 }
 
 // ValidateTOTP validates a passcode against the secret.
+// A code stays valid for its whole period; use TOTP.Validate to reject reuse.
 func ValidateTOTP(passcode string, secret string) bool {
 	return totp.Validate(passcode, secret)
 }
@@ -39,3 +63,106 @@ func GenerateQRCode(key *otp.Key) ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
+
+// TOTP generates and validates TOTP codes with configured parameters.
+// Each user can use a time step only once: a code (or an older one) that was
+// already accepted is rejected, so an intercepted code cannot be replayed.
+type TOTP struct {
+	issuer     string
+	digits     otp.Digits
+	period     uint
+	algorithm  otp.Algorithm
+	skew       uint
+	secretSize uint
+	cache      cache.Cache
+}
+
+// NewTOTP creates a TOTP. The cache records the last accepted step per user
+// and must support Eval (Redis). Call opts.Complete first to fill in defaults.
+func NewTOTP(opts *options.TOTPOptions, c cache.Cache) (*TOTP, error) {
+	if opts.Period == 0 {
+		return nil, fmt.Errorf("totp period must be greater than 0")
+	}
+	if opts.Digits != 6 && opts.Digits != 8 {
+		return nil, fmt.Errorf("totp digits must be 6 or 8, got %d", opts.Digits)
+	}
+	if opts.Skew > maxTOTPSkew {
+		return nil, fmt.Errorf("totp skew must not exceed %d periods", maxTOTPSkew)
+	}
+	t := &TOTP{
+		issuer:     opts.Issuer,
+		digits:     otp.Digits(opts.Digits),
+		period:     opts.Period,
+		skew:       opts.Skew,
+		secretSize: opts.SecretSize,
+		cache:      c,
+	}
+	switch strings.ToUpper(opts.Algorithm) {
+	case "SHA1", "":
+		t.algorithm = otp.AlgorithmSHA1
+	case "SHA256":
+		t.algorithm = otp.AlgorithmSHA256
+	case "SHA512":
+		t.algorithm = otp.AlgorithmSHA512
+	default:
+		return nil, fmt.Errorf("unsupported totp algorithm %q", opts.Algorithm)
+	}
+	return t, nil
+}
+
+// Generate creates a new key, its URL (key.URL()) carries the parameters to authenticator apps
+func (t *TOTP) Generate(accountName string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      t.issuer,
+		AccountName: accountName,
+		Period:      t.period,
+		SecretSize:  t.secretSize,
+		Digits:      t.digits,
+		Algorithm:   t.algorithm,
+	})
+}
+
+// Validate checks the passcode within the skew window and consumes its time step.
+// It returns false for wrong codes and for steps at or before the last accepted one.
+func (t *TOTP) Validate(ctx context.Context, userID int, passcode, secret string) (bool, error) {
+	step, ok, err := t.match(passcode, secret, time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+
+	ttl := time.Duration(2*t.skew+2) * time.Duration(t.period) * time.Second
+	res, err := t.cache.Eval(ctx, totpUseStepScript, []string{totpLastStepPrefix + strconv.Itoa(userID)}, step, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	fresh, _ := res.(int64)
+	return fresh == 1, nil
+}
+
+// Check verifies the passcode without consuming it, e.g. to confirm an enrollment
+func (t *TOTP) Check(passcode, secret string) (bool, error) {
+	_, ok, err := t.match(passcode, secret, time.Now())
+	return ok, err
+}
+
+// match returns the time step the passcode belongs to
+func (t *TOTP) match(passcode, secret string, now time.Time) (int64, bool, error) {
+	passcode = strings.TrimSpace(passcode)
+	if len(passcode) != t.digits.Length() {
+		return 0, false, nil
+	}
+
+	opts := totp.ValidateOpts{Period: t.period, Digits: t.digits, Algorithm: t.algorithm}
+	current := now.Unix() / int64(t.period)
+	for i := -int64(t.skew); i <= int64(t.skew); i++ {
+		step := current + i
+		code, err := totp.GenerateCodeCustom(secret, time.Unix(step*int64(t.period), 0), opts)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(passcode)) == 1 {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
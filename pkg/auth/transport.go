@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Credentials is an access key pair
+type Credentials struct {
+	AccessKey string
+	SecretKey string
+}
+
+// CredentialsProvider returns the credentials used to sign a request
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials always returns the same key pair
+type StaticCredentials Credentials
+
+func (c StaticCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	return Credentials(c), nil
+}
+
+// RefreshingCredentials caches credentials returned by fetch for ttl,
+// for key pairs rotated by a secret manager
+type RefreshingCredentials struct {
+	fetch func(ctx context.Context) (Credentials, error)
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	current   Credentials
+	expiresAt time.Time
+}
+
+// NewRefreshingCredentials creates a RefreshingCredentials
+func NewRefreshingCredentials(fetch func(ctx context.Context) (Credentials, error), ttl time.Duration) *RefreshingCredentials {
+	return &RefreshingCredentials{fetch: fetch, ttl: ttl}
+}
+
+func (c *RefreshingCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Now().Before(c.expiresAt) {
+		return c.current, nil
+	}
+	creds, err := c.fetch(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c.current = creds
+	c.expiresAt = time.Now().Add(c.ttl)
+	return creds, nil
+}
+
+// Expire forces the next call to fetch, e.g. after the server rejected the key
+func (c *RefreshingCredentials) Expire() {
+	c.mu.Lock()
+	c.expiresAt = time.Time{}
+	c.mu.Unlock()
+}
+
+// SigningTransport is an http.RoundTripper that signs every request with an access key.
+//
+// When the server answers with X-Nuwa-Server-Date (errors.ErrRequestTimeSkewed),
+// the clock offset is remembered and the request is signed and sent once more.
+// Retrying needs a replayable body: requests signed with a declared
+// X-Nuwa-Content-Sha256 are only retried when GetBody is set.
+type SigningTransport struct {
+	// Base defaults to http.DefaultTransport
+	Base http.RoundTripper
+
+	Credentials CredentialsProvider
+
+	// Signer signs with signature v2. When nil the request is signed with SignRequest (v1).
+	Signer *SignerV2
+
+	offset atomic.Int64 // server time - local time, in nanoseconds
+}
+
+// NewSigningTransport creates a SigningTransport
+func NewSigningTransport(base http.RoundTripper, creds CredentialsProvider, signer *SignerV2) *SigningTransport {
+	return &SigningTransport{Base: base, Credentials: creds, Signer: signer}
+}
+
+// NewSigningClient returns an *http.Client signing its requests with a v2 signer
+func NewSigningClient(creds CredentialsProvider, region, service string) *http.Client {
+	return &http.Client{Transport: NewSigningTransport(nil, creds, NewSignerV2(region, service))}
+}
+
+func (t *SigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed, err := t.sign(req)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	resp, err := t.base().RoundTrip(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	serverDate := resp.Header.Get(HeaderNuwaServerDate)
+	if serverDate == "" || (signed.GetBody == nil && signed.Body != nil && signed.Body != http.NoBody) {
+		return resp, nil
+	}
+	serverTime, err := time.Parse(TimeFormatV2, serverDate)
+	if err != nil {
+		return resp, nil
+	}
+	t.offset.Store(int64(time.Until(serverTime)))
+
+	retry := req.Clone(req.Context())
+	if signed.GetBody != nil {
+		body, err := signed.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	signed, err = t.sign(retry)
+	if err != nil {
+		return nil, err
+	}
+	return t.base().RoundTrip(signed)
+}
+
+// sign signs a copy of req, http.RoundTripper must not modify the request
+func (t *SigningTransport) sign(req *http.Request) (*http.Request, error) {
+	creds, err := t.Credentials.Credentials(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	signed := req.Clone(req.Context())
+	if t.Signer == nil {
+		signed.Header.Set(HeaderNuwaDate, t.now().UTC().Format(http.TimeFormat))
+		err = SignRequest(signed, creds.AccessKey, creds.SecretKey)
+	} else {
+		signer := *t.Signer
+		signer.Now = t.now
+		err = signer.Sign(signed, creds.AccessKey, creds.SecretKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// now returns the local time corrected by the last observed server clock offset
+func (t *SigningTransport) now() time.Time {
+	return time.Now().Add(time.Duration(t.offset.Load()))
+}
+
+func (t *SigningTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
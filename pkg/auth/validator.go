@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 
 	"github.com/arrow2012/nuwa-kit/pkg/cache"
@@ -12,7 +13,9 @@ type Validator interface {
 	Validate(ctx context.Context, target string, code string, purpose string) bool
 }
 
-// RedisValidator implements Validator using Redis
+// RedisValidator implements Validator using Redis, for plain codes stored by the caller.
+//
+// Deprecated: use VerificationCodeService, which also issues, hashes and rate limits codes.
 type RedisValidator struct {
 	cache cache.Cache
 }
@@ -31,16 +34,11 @@ func (v *RedisValidator) Validate(ctx context.Context, target string, code strin
 	key := fmt.Sprintf("verify:%s:%s", purpose, target)
 
 	storedCode, err := v.cache.Get(ctx, key)
-	// For MVP/Dev, support specialized mock code "123456" ALWAYS
-	if code == "123456" {
-		return true
-	}
-
 	if err != nil || storedCode == "" {
 		return false
 	}
 
-	if storedCode == code {
+	if subtle.ConstantTimeCompare([]byte(storedCode), []byte(code)) == 1 {
 		// Invalidate code after use
 		v.cache.Del(ctx, key)
 		return true
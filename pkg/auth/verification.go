@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+)
+
+const (
+	verifyCodePrefix     = "verify:"
+	verifyAttemptsPrefix = "verify:attempts:"
+	verifyCooldownPrefix = "verify:cooldown:"
+)
+
+// verifyCooldownScript starts the resend cooldown if none is running,
+// otherwise returns the remaining milliseconds
+const verifyCooldownScript = `
+if redis.call('SET', KEYS[1], '1', 'NX', 'PX', ARGV[1]) then
+	return 0
+end
+return redis.call('PTTL', KEYS[1])`
+
+// verifyCheckScript consumes the code (KEYS[1]) if it matches ARGV[1], otherwise
+// counts the attempt (KEYS[2], expiring after ARGV[3] ms) and discards the code
+// after ARGV[2] attempts. Returns 1 (match), 0 (wrong or no code) or -1 (discarded).
+const verifyCheckScript = `
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+	return 0
+end
+if stored == ARGV[1] then
+	redis.call('DEL', KEYS[1], KEYS[2])
+	return 1
+end
+local n = redis.call('INCR', KEYS[2])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[2], ARGV[3])
+end
+if n >= tonumber(ARGV[2]) then
+	redis.call('DEL', KEYS[1])
+	return -1
+end
+return 0`
+
+// CodeSender delivers verification codes. email.Sender satisfies it.
+type CodeSender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// CodeMessage renders the message carrying a code
+type CodeMessage func(purpose, code string, ttl time.Duration) (subject, body string)
+
+// DefaultCodeMessage is the plain text message used unless SetMessage is called
+func DefaultCodeMessage(purpose, code string, ttl time.Duration) (string, string) {
+	return "Your verification code",
+		fmt.Sprintf("Your verification code is %s. It expires in %d minutes.\n"+
+			"If you did not request it, you can ignore this message.", code, int(ttl.Minutes()))
+}
+
+// VerificationCodeService issues and checks one-time codes per target (e-mail) and purpose
+// (login, reset_password, ...).
+//
+// Codes are random digits, stored as an HMAC in the cache until their TTL.
+// Sending again replaces the previous code, at most once per resend cooldown.
+// A code is discarded after MaxAttempts wrong guesses. It needs cache.Eval (Redis).
+type VerificationCodeService struct {
+	opts     options.VerificationCodeOptions
+	cooldown time.Duration
+	key      []byte
+	cache    cache.Cache
+	sender   CodeSender
+	message  CodeMessage
+}
+
+// NewVerificationCodeService creates a VerificationCodeService.
+// The resend cooldown is authOpts.SendCodeRateLimit, codes are keyed with authOpts.EncryptionKey.
+func NewVerificationCodeService(opts *options.VerificationCodeOptions, authOpts *options.AuthOptions, c cache.Cache, sender CodeSender) *VerificationCodeService {
+	return &VerificationCodeService{
+		opts:     *opts,
+		cooldown: authOpts.SendCodeRateLimit,
+		key:      []byte(authOpts.EncryptionKey),
+		cache:    c,
+		sender:   sender,
+		message:  DefaultCodeMessage,
+	}
+}
+
+// SetMessage replaces the message template
+func (s *VerificationCodeService) SetMessage(m CodeMessage) {
+	s.message = m
+}
+
+// Send generates a code and delivers it to target.
+// Within the resend cooldown it returns errors.ErrTooManyRequests with
+// {"retry_after": seconds} as details.
+func (s *VerificationCodeService) Send(ctx context.Context, target, purpose string) error {
+	if s.cooldown > 0 {
+		res, err := s.cache.Eval(ctx, verifyCooldownScript, []string{verifyCooldownPrefix + purpose + ":" + target}, s.cooldown.Milliseconds())
+		if err != nil {
+			return err
+		}
+		if remaining, _ := res.(int64); remaining > 0 {
+			retryAfter := (time.Duration(remaining)*time.Millisecond + time.Second - 1) / time.Second
+			return apperrors.WithDetails(apperrors.ErrTooManyRequests, map[string]int64{"retry_after": int64(retryAfter)})
+		}
+	}
+
+	code, err := s.generate()
+	if err != nil {
+		return err
+	}
+	if err := s.cache.Set(ctx, s.codeKey(target, purpose), s.hash(target, purpose, code), s.opts.TTL); err != nil {
+		return err
+	}
+	if err := s.cache.Del(ctx, verifyAttemptsPrefix+purpose+":"+target); err != nil {
+		return err
+	}
+
+	subject, body := s.message(purpose, code, s.opts.TTL)
+	return s.sender.Send(ctx, target, subject, body)
+}
+
+// Verify consumes the code of target and purpose.
+// Errors are errors.ErrVerifyCodeInvalid (wrong, expired or never sent), or
+// ErrTooManyRequests once MaxAttempts wrong codes discarded it.
+func (s *VerificationCodeService) Verify(ctx context.Context, target, code, purpose string) error {
+	// Checked and counted in one script, so that concurrent guesses cannot
+	// all compare against the code before the attempt limit discards it
+	res, err := s.cache.Eval(ctx, verifyCheckScript,
+		[]string{s.codeKey(target, purpose), verifyAttemptsPrefix + purpose + ":" + target},
+		s.hash(target, purpose, code), s.opts.MaxAttempts, s.opts.TTL.Milliseconds())
+	if err != nil {
+		return err
+	}
+	switch n, _ := res.(int64); n {
+	case 1:
+		return nil
+	case -1:
+		return apperrors.ErrTooManyRequests
+	default:
+		return apperrors.ErrVerifyCodeInvalid
+	}
+}
+
+// Validate implements Validator
+func (s *VerificationCodeService) Validate(ctx context.Context, target string, code string, purpose string) bool {
+	return s.Verify(ctx, target, code, purpose) == nil
+}
+
+func (s *VerificationCodeService) generate() (string, error) {
+	if s.opts.TestMode {
+		return s.opts.TestCode, nil
+	}
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(s.opts.Length)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", s.opts.Length, n), nil
+}
+
+func (s *VerificationCodeService) codeKey(target, purpose string) string {
+	return verifyCodePrefix + purpose + ":" + target
+}
+
+// hash binds the code to its target and purpose, so a leaked cache entry
+// cannot be brute-forced offline without the key
+func (s *VerificationCodeService) hash(target, purpose, code string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(purpose + "\x00" + target + "\x00" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,650 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+)
+
+const webauthnSessionPrefix = "auth:webauthn:challenge:"
+
+// webauthnConsumeScript returns and deletes a challenge session, so that it can be used once
+const webauthnConsumeScript = `
+local v = redis.call('GET', KEYS[1])
+if v then
+	redis.call('DEL', KEYS[1])
+end
+return v`
+
+// Authenticator data flags
+const (
+	webauthnFlagUP = 0x01 // User present
+	webauthnFlagUV = 0x04 // User verified
+	webauthnFlagBE = 0x08 // Backup eligible
+	webauthnFlagBS = 0x10 // Backup state
+	webauthnFlagAT = 0x40 // Attested credential data included
+	webauthnFlagED = 0x80 // Extension data included
+)
+
+// Attestation types recorded on credentials
+const (
+	AttestationNone  = "none"
+	AttestationSelf  = "self"
+	AttestationBasic = "basic" // packed with x5c, chain not checked against a metadata service
+)
+
+// oidFIDOGenCeAAGUID is the certificate extension carrying the authenticator AAGUID
+var oidFIDOGenCeAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// WebAuthnCredential is a registered authenticator, to be persisted with the user
+type WebAuthnCredential struct {
+	ID              []byte    `json:"id"`
+	PublicKey       []byte    `json:"public_key"` // COSE_Key
+	Algorithm       int64     `json:"alg"`
+	SignCount       uint32    `json:"sign_count"`
+	AAGUID          []byte    `json:"aaguid"`
+	AttestationType string    `json:"attestation_type"`
+	Transports      []string  `json:"transports,omitempty"`
+	UserVerified    bool      `json:"user_verified"`
+	BackupEligible  bool      `json:"backup_eligible"`
+	BackupState     bool      `json:"backup_state"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastUsedAt      time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthnUser is the account a ceremony runs for.
+// ID is the user handle: random bytes, not the username or e-mail (it is stored on the authenticator).
+type WebAuthnUser struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+	Credentials []WebAuthnCredential
+}
+
+// PublicKeyCredentialCreationOptions is passed to navigator.credentials.create (binary fields base64url)
+type PublicKeyCredentialCreationOptions struct {
+	RP                     webauthnEntity              `json:"rp"`
+	User                   webauthnUserEntity          `json:"user"`
+	Challenge              string                      `json:"challenge"`
+	PubKeyCredParams       []webauthnCredParam         `json:"pubKeyCredParams"`
+	Timeout                int64                       `json:"timeout"`
+	ExcludeCredentials     []webauthnCredDescriptor    `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection webauthnAuthenticatorSelect `json:"authenticatorSelection"`
+	Attestation            string                      `json:"attestation"`
+}
+
+// PublicKeyCredentialRequestOptions is passed to navigator.credentials.get (binary fields base64url)
+type PublicKeyCredentialRequestOptions struct {
+	Challenge        string                   `json:"challenge"`
+	Timeout          int64                    `json:"timeout"`
+	RPID             string                   `json:"rpId"`
+	AllowCredentials []webauthnCredDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                   `json:"userVerification"`
+}
+
+type webauthnEntity struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type webauthnUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type webauthnCredParam struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type webauthnCredDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type webauthnAuthenticatorSelect struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON serialization of the PublicKeyCredential
+// returned by navigator.credentials.create (binary fields base64url)
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON serialization of the PublicKeyCredential
+// returned by navigator.credentials.get (binary fields base64url)
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// UserHandle returns the user handle of a discoverable credential, nil if absent.
+// Use it to find the user of a passkey login before FinishLogin.
+func (r *AssertionResponse) UserHandle() ([]byte, error) {
+	if r.Response.UserHandle == "" {
+		return nil, nil
+	}
+	return decodeBase64URL(r.Response.UserHandle)
+}
+
+// webauthnSession is the server side state of a ceremony
+type webauthnSession struct {
+	UserID           []byte   `json:"user_id,omitempty"` // Empty for discoverable logins
+	AllowCredentials [][]byte `json:"allow_credentials,omitempty"`
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	// Attested credential data, present on registration
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// WebAuthn runs registration and authentication ceremonies for a relying party.
+//
+// Begin* store the challenge in the cache for the ceremony timeout and return the
+// options for the browser; Finish* consume the challenge and verify the response.
+// VerifyRegistration and VerifyAssertion check a response against a known challenge
+// without the cache, for recorded authenticator fixtures.
+type WebAuthn struct {
+	opts  options.WebAuthnOptions
+	cache cache.Cache
+}
+
+// NewWebAuthn creates a WebAuthn relying party. Finish* need cache.Eval (Redis).
+func NewWebAuthn(opts *options.WebAuthnOptions, c cache.Cache) *WebAuthn {
+	return &WebAuthn{opts: *opts, cache: c}
+}
+
+// BeginRegistration creates a registration challenge for the user.
+// Already registered credentials are excluded.
+func (w *WebAuthn) BeginRegistration(ctx context.Context, user *WebAuthnUser) (*PublicKeyCredentialCreationOptions, error) {
+	challenge, err := w.newChallenge(ctx, &webauthnSession{UserID: user.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicKeyCredentialCreationOptions{
+		RP: webauthnEntity{ID: w.opts.RPID, Name: w.opts.RPName},
+		User: webauthnUserEntity{
+			ID:          encodeBase64URL(user.ID),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		Challenge: challenge,
+		PubKeyCredParams: []webauthnCredParam{
+			{Type: "public-key", Alg: COSEAlgES256},
+			{Type: "public-key", Alg: COSEAlgEdDSA},
+			{Type: "public-key", Alg: COSEAlgRS256},
+		},
+		Timeout:            w.opts.Timeout.Milliseconds(),
+		ExcludeCredentials: credentialDescriptors(user.Credentials),
+		AuthenticatorSelection: webauthnAuthenticatorSelect{
+			ResidentKey:      w.opts.ResidentKey,
+			UserVerification: w.opts.UserVerification,
+		},
+		Attestation: w.opts.Attestation,
+	}, nil
+}
+
+// FinishRegistration verifies the response to BeginRegistration and returns the credential to persist.
+// Failures are errors.ErrWebAuthnInvalid with the reason as details.
+func (w *WebAuthn) FinishRegistration(ctx context.Context, user *WebAuthnUser, resp *RegistrationResponse) (*WebAuthnCredential, error) {
+	challenge, session, err := w.consumeChallenge(ctx, resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(session.UserID, user.ID) {
+		return nil, webauthnError("user mismatch")
+	}
+	return w.VerifyRegistration(challenge, user, resp)
+}
+
+// VerifyRegistration verifies a registration response against the challenge (WebAuthn §7.1)
+func (w *WebAuthn) VerifyRegistration(challenge []byte, user *WebAuthnUser, resp *RegistrationResponse) (*WebAuthnCredential, error) {
+	clientDataJSON, err := w.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := decodeBase64URL(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, webauthnError("attestation object encoding")
+	}
+	decoded, _, err := cborDecode(raw)
+	if err != nil {
+		return nil, webauthnError("attestation object cbor")
+	}
+	attObj, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, webauthnError("attestation object cbor")
+	}
+	format, _ := attObj["fmt"].(string)
+	attStmt, _ := attObj["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attObj["authData"].([]byte)
+
+	authData, err := w.parseAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.Flags&webauthnFlagAT == 0 || authData.CredentialID == nil {
+		return nil, webauthnError("missing attested credential data")
+	}
+	if rawID, err := decodeBase64URL(resp.RawID); err != nil || !bytes.Equal(rawID, authData.CredentialID) {
+		return nil, webauthnError("credential id mismatch")
+	}
+	for _, c := range user.Credentials {
+		if bytes.Equal(c.ID, authData.CredentialID) {
+			return nil, webauthnError("credential already registered")
+		}
+	}
+
+	pub, alg, _, err := parseCOSEKey(authData.PublicKey)
+	if err != nil {
+		return nil, webauthnError("unsupported credential public key")
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+
+	var attestationType string
+	switch format {
+	case "none":
+		if len(attStmt) != 0 {
+			return nil, webauthnError("none attestation with statement")
+		}
+		attestationType = AttestationNone
+
+	case "packed":
+		stmtAlg, _ := attStmt["alg"].(int64)
+		sig, _ := attStmt["sig"].([]byte)
+		x5c, hasX5C := attStmt["x5c"].([]interface{})
+		if !hasX5C {
+			// Self attestation: signed by the credential key itself
+			if stmtAlg != alg || verifyCOSESignature(pub, alg, signed, sig) != nil {
+				return nil, webauthnError("packed self attestation signature")
+			}
+			attestationType = AttestationSelf
+			break
+		}
+		if err := verifyPackedX5C(x5c, stmtAlg, signed, sig, authData.AAGUID); err != nil {
+			return nil, webauthnError(err.Error())
+		}
+		attestationType = AttestationBasic
+
+	default:
+		return nil, webauthnError("unsupported attestation format")
+	}
+
+	return &WebAuthnCredential{
+		ID:              authData.CredentialID,
+		PublicKey:       authData.PublicKey,
+		Algorithm:       alg,
+		SignCount:       authData.SignCount,
+		AAGUID:          authData.AAGUID,
+		AttestationType: attestationType,
+		Transports:      resp.Response.Transports,
+		UserVerified:    authData.Flags&webauthnFlagUV != 0,
+		BackupEligible:  authData.Flags&webauthnFlagBE != 0,
+		BackupState:     authData.Flags&webauthnFlagBS != 0,
+		CreatedAt:       time.Now(),
+	}, nil
+}
+
+// BeginLogin creates an authentication challenge. With a nil user the
+// challenge is for a discoverable credential (passkey) of any user.
+func (w *WebAuthn) BeginLogin(ctx context.Context, user *WebAuthnUser) (*PublicKeyCredentialRequestOptions, error) {
+	session := &webauthnSession{}
+	var allow []webauthnCredDescriptor
+	if user != nil {
+		session.UserID = user.ID
+		for _, c := range user.Credentials {
+			session.AllowCredentials = append(session.AllowCredentials, c.ID)
+		}
+		allow = credentialDescriptors(user.Credentials)
+	}
+
+	challenge, err := w.newChallenge(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKeyCredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          w.opts.Timeout.Milliseconds(),
+		RPID:             w.opts.RPID,
+		AllowCredentials: allow,
+		UserVerification: w.opts.UserVerification,
+	}, nil
+}
+
+// FinishLogin verifies the response to BeginLogin for the user owning the credential
+// (for passkeys, found through resp.UserHandle) and returns the credential with its
+// updated sign count and last use, to persist.
+// Failures are errors.ErrWebAuthnInvalid with the reason as details.
+func (w *WebAuthn) FinishLogin(ctx context.Context, user *WebAuthnUser, resp *AssertionResponse) (*WebAuthnCredential, error) {
+	challenge, session, err := w.consumeChallenge(ctx, resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if len(session.UserID) > 0 && !bytes.Equal(session.UserID, user.ID) {
+		return nil, webauthnError("user mismatch")
+	}
+	if len(session.AllowCredentials) > 0 {
+		rawID, _ := decodeBase64URL(resp.RawID)
+		allowed := false
+		for _, id := range session.AllowCredentials {
+			allowed = allowed || bytes.Equal(id, rawID)
+		}
+		if !allowed {
+			return nil, webauthnError("credential not allowed")
+		}
+	}
+	return w.VerifyAssertion(challenge, user, resp)
+}
+
+// VerifyAssertion verifies an authentication response against the challenge (WebAuthn §7.2).
+// A sign count that does not increase indicates a cloned authenticator and is rejected.
+// A sign count of 0 means the authenticator has no counter (e.g. synced passkeys) and is
+// accepted; the stored count is then kept.
+func (w *WebAuthn) VerifyAssertion(challenge []byte, user *WebAuthnUser, resp *AssertionResponse) (*WebAuthnCredential, error) {
+	rawID, err := decodeBase64URL(resp.RawID)
+	if err != nil {
+		return nil, webauthnError("credential id encoding")
+	}
+	var cred *WebAuthnCredential
+	for i := range user.Credentials {
+		if bytes.Equal(user.Credentials[i].ID, rawID) {
+			c := user.Credentials[i]
+			cred = &c
+			break
+		}
+	}
+	if cred == nil {
+		return nil, webauthnError("unknown credential")
+	}
+	if handle, err := resp.UserHandle(); err != nil || (handle != nil && !bytes.Equal(handle, user.ID)) {
+		return nil, webauthnError("user handle mismatch")
+	}
+
+	clientDataJSON, err := w.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+	rawAuthData, err := decodeBase64URL(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, webauthnError("authenticator data encoding")
+	}
+	authData, err := w.parseAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := decodeBase64URL(resp.Response.Signature)
+	if err != nil {
+		return nil, webauthnError("signature encoding")
+	}
+	pub, alg, _, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return nil, webauthnError("stored public key")
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(pub, alg, signed, sig); err != nil {
+		return nil, webauthnError("signature")
+	}
+
+	// Authenticators without a counter always return 0 (WebAuthn §7.2 step 21);
+	// once a counter was seen, anything but a higher value may be a clone
+	if authData.SignCount != 0 || cred.SignCount != 0 {
+		if authData.SignCount <= cred.SignCount {
+			return nil, webauthnError("sign count did not increase")
+		}
+		cred.SignCount = authData.SignCount
+	}
+	cred.UserVerified = authData.Flags&webauthnFlagUV != 0
+	cred.BackupState = authData.Flags&webauthnFlagBS != 0
+	cred.LastUsedAt = time.Now()
+	return cred, nil
+}
+
+// verifyClientData checks type, challenge and origin, and returns the raw JSON
+func (w *WebAuthn) verifyClientData(encoded, ceremony string, challenge []byte) ([]byte, error) {
+	raw, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, webauthnError("client data encoding")
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, webauthnError("client data json")
+	}
+	if cd.Type != ceremony {
+		return nil, webauthnError("client data type")
+	}
+	if got, err := decodeBase64URL(cd.Challenge); err != nil || !bytes.Equal(got, challenge) {
+		return nil, webauthnError("challenge mismatch")
+	}
+	originOK := false
+	for _, o := range w.opts.Origins {
+		originOK = originOK || o == cd.Origin
+	}
+	if !originOK {
+		return nil, webauthnError("origin not allowed")
+	}
+	return raw, nil
+}
+
+// parseAuthData parses the authenticator data and checks the RP ID hash and flags
+func (w *WebAuthn) parseAuthData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, webauthnError("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(w.opts.RPID))
+	if !bytes.Equal(ad.RPIDHash, rpIDHash[:]) {
+		return nil, webauthnError("rp id mismatch")
+	}
+	if ad.Flags&webauthnFlagUP == 0 {
+		return nil, webauthnError("user not present")
+	}
+	if w.opts.UserVerification == "required" && ad.Flags&webauthnFlagUV == 0 {
+		return nil, webauthnError("user not verified")
+	}
+	if ad.Flags&webauthnFlagBS != 0 && ad.Flags&webauthnFlagBE == 0 {
+		return nil, webauthnError("backup state without backup eligibility")
+	}
+
+	rest := data[37:]
+	if ad.Flags&webauthnFlagAT != 0 {
+		if len(rest) < 18 {
+			return nil, webauthnError("attested credential data too short")
+		}
+		ad.AAGUID = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen > 1023 || len(rest) < idLen {
+			return nil, webauthnError("credential id length")
+		}
+		ad.CredentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, _, n, err := parseCOSEKey(rest)
+		if err != nil {
+			return nil, webauthnError("credential public key")
+		}
+		ad.PublicKey = rest[:n]
+		rest = rest[n:]
+	}
+	if ad.Flags&webauthnFlagED != 0 {
+		_, n, err := cborDecode(rest)
+		if err != nil {
+			return nil, webauthnError("extension data")
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return nil, webauthnError("trailing authenticator data")
+	}
+	return ad, nil
+}
+
+// verifyPackedX5C verifies a packed attestation signed by an attestation certificate (WebAuthn §8.2.1)
+func verifyPackedX5C(x5c []interface{}, alg int64, signed, sig, aaguid []byte) error {
+	if len(x5c) == 0 {
+		return errors.New("packed attestation without certificate")
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return errors.New("packed attestation certificate")
+	}
+	if err := verifyCOSESignature(cert.PublicKey, alg, signed, sig); err != nil {
+		return errors.New("packed attestation signature")
+	}
+
+	if cert.Version != 3 || cert.IsCA || !hasSubjectOU(cert.Subject, "Authenticator Attestation") {
+		return errors.New("packed attestation certificate requirements")
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidFIDOGenCeAAGUID) {
+			continue
+		}
+		var certAAGUID []byte
+		if _, err := asn1.Unmarshal(ext.Value, &certAAGUID); err != nil || !bytes.Equal(certAAGUID, aaguid) {
+			return errors.New("packed attestation aaguid mismatch")
+		}
+	}
+	return nil
+}
+
+func hasSubjectOU(name pkix.Name, ou string) bool {
+	for _, v := range name.OrganizationalUnit {
+		if v == ou {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *WebAuthn) newChallenge(ctx context.Context, session *webauthnSession) (string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	encoded := encodeBase64URL(challenge)
+	if err := w.cache.Set(ctx, webauthnSessionPrefix+encoded, string(data), w.opts.Timeout); err != nil {
+		return "", err
+	}
+	return encoded, nil
+}
+
+// consumeChallenge loads and deletes the session of the challenge found in the client data
+func (w *WebAuthn) consumeChallenge(ctx context.Context, encodedClientData string) ([]byte, *webauthnSession, error) {
+	raw, err := decodeBase64URL(encodedClientData)
+	if err != nil {
+		return nil, nil, webauthnError("client data encoding")
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, nil, webauthnError("client data json")
+	}
+	challenge, err := decodeBase64URL(cd.Challenge)
+	if err != nil || len(challenge) == 0 {
+		return nil, nil, webauthnError("challenge encoding")
+	}
+
+	res, err := w.cache.Eval(ctx, webauthnConsumeScript, []string{webauthnSessionPrefix + encodeBase64URL(challenge)})
+	if err != nil {
+		if cache.IsMiss(err) {
+			return nil, nil, webauthnError("challenge expired")
+		}
+		return nil, nil, err
+	}
+	data, ok := res.(string)
+	if !ok {
+		return nil, nil, webauthnError("challenge expired")
+	}
+
+	var session webauthnSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, nil, err
+	}
+	return challenge, &session, nil
+}
+
+func credentialDescriptors(creds []WebAuthnCredential) []webauthnCredDescriptor {
+	out := make([]webauthnCredDescriptor, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, webauthnCredDescriptor{Type: "public-key", ID: encodeBase64URL(c.ID), Transports: c.Transports})
+	}
+	return out
+}
+
+func webauthnError(reason string) error {
+	return apperrors.WithDetails(apperrors.ErrWebAuthnInvalid, map[string]string{"reason": reason})
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeBase64URL accepts base64url with or without padding
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(trimPadding(s))
+}
+
+func trimPadding(s string) string {
+	for len(s) > 0 && s[len(s)-1] == '=' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
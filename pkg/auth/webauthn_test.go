@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/cache"
+	apperrors "github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+	"github.com/arrow2012/nuwa-kit/pkg/options"
+	"github.com/redis/go-redis/v9"
+)
+
+// webauthnFixture is a ceremony recorded from a software authenticator (testdata/webauthn)
+type webauthnFixture struct {
+	RPID       string `json:"rp_id"`
+	Origin     string `json:"origin"`
+	Challenge  string `json:"challenge"`
+	UserID     string `json:"user_id"`
+	Credential *struct {
+		ID        string `json:"id"`
+		PublicKey string `json:"public_key"`
+		Alg       int64  `json:"alg"`
+	} `json:"credential"`
+	Response json.RawMessage `json:"response"`
+}
+
+func loadWebAuthnFixture(t *testing.T, name string) *webauthnFixture {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "webauthn", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f webauthnFixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	return &f
+}
+
+func (f *webauthnFixture) webauthn(c cache.Cache) *WebAuthn {
+	opts := options.NewWebAuthnOptions()
+	opts.RPID = f.RPID
+	opts.RPName = "Nuwa"
+	opts.Origins = []string{f.Origin}
+	return NewWebAuthn(opts, c)
+}
+
+func (f *webauthnFixture) challenge(t *testing.T) []byte {
+	t.Helper()
+	b, err := decodeBase64URL(f.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// user returns the user of the fixture, owning its credential with the given sign count
+func (f *webauthnFixture) user(t *testing.T, signCount uint32) *WebAuthnUser {
+	t.Helper()
+	id, err := decodeBase64URL(f.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &WebAuthnUser{ID: id, Name: "alice"}
+	if f.Credential != nil {
+		credID, _ := decodeBase64URL(f.Credential.ID)
+		pub, _ := decodeBase64URL(f.Credential.PublicKey)
+		user.Credentials = []WebAuthnCredential{{ID: credID, PublicKey: pub, Algorithm: f.Credential.Alg, SignCount: signCount}}
+	}
+	return user
+}
+
+func (f *webauthnFixture) registration(t *testing.T) *RegistrationResponse {
+	t.Helper()
+	var resp RegistrationResponse
+	if err := json.Unmarshal(f.Response, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func (f *webauthnFixture) assertion(t *testing.T) *AssertionResponse {
+	t.Helper()
+	var resp AssertionResponse
+	if err := json.Unmarshal(f.Response, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return &resp
+}
+
+func webauthnReason(err error) string {
+	if details, ok := apperrors.Details(err).(map[string]string); ok {
+		return details["reason"]
+	}
+	return ""
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		attestation string
+	}{
+		{"registration-none", AttestationNone},
+		{"registration-packed-self", AttestationSelf},
+		{"registration-packed-x5c", AttestationBasic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			f := loadWebAuthnFixture(t, tt.fixture)
+			cred, err := f.webauthn(nil).VerifyRegistration(f.challenge(t), f.user(t, 0), f.registration(t))
+			if err != nil {
+				t.Fatalf("VerifyRegistration: %v (%s)", err, webauthnReason(err))
+			}
+			if cred.AttestationType != tt.attestation {
+				t.Errorf("attestation type = %q, want %q", cred.AttestationType, tt.attestation)
+			}
+			if cred.Algorithm != COSEAlgES256 {
+				t.Errorf("algorithm = %d, want %d", cred.Algorithm, COSEAlgES256)
+			}
+			if !cred.UserVerified {
+				t.Error("user verified flag not recorded")
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationFailures(t *testing.T) {
+	f := loadWebAuthnFixture(t, "registration-packed-self")
+
+	tests := []struct {
+		name   string
+		modify func(w *WebAuthn, challenge []byte, user *WebAuthnUser)
+		reason string
+	}{
+		{"wrong origin", func(w *WebAuthn, _ []byte, _ *WebAuthnUser) { w.opts.Origins = []string{"https://evil.example"} }, "origin not allowed"},
+		{"wrong rp id", func(w *WebAuthn, _ []byte, _ *WebAuthnUser) { w.opts.RPID = "example.com" }, "rp id mismatch"},
+		{"wrong challenge", func(_ *WebAuthn, challenge []byte, _ *WebAuthnUser) { challenge[0] ^= 0xff }, "challenge mismatch"},
+		{"already registered", func(_ *WebAuthn, _ []byte, user *WebAuthnUser) {
+			id, _ := decodeBase64URL(f.registration(t).RawID)
+			user.Credentials = append(user.Credentials, WebAuthnCredential{ID: id})
+		}, "credential already registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, challenge, user := f.webauthn(nil), f.challenge(t), f.user(t, 0)
+			tt.modify(w, challenge, user)
+			_, err := w.VerifyRegistration(challenge, user, f.registration(t))
+			if reason := webauthnReason(err); reason != tt.reason {
+				t.Errorf("error = %v (%q), want reason %q", err, reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		stored    uint32
+		wantCount uint32
+	}{
+		{"assertion-es256", 0, 5},
+		{"assertion-es256", 4, 5},
+		// The EdDSA authenticator has no counter: 0 is accepted while nothing else was seen
+		{"assertion-eddsa", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			f := loadWebAuthnFixture(t, tt.fixture)
+			cred, err := f.webauthn(nil).VerifyAssertion(f.challenge(t), f.user(t, tt.stored), f.assertion(t))
+			if err != nil {
+				t.Fatalf("VerifyAssertion: %v (%s)", err, webauthnReason(err))
+			}
+			if cred.SignCount != tt.wantCount {
+				t.Errorf("sign count = %d, want %d", cred.SignCount, tt.wantCount)
+			}
+			if cred.LastUsedAt.IsZero() {
+				t.Error("last use not recorded")
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		stored  uint32
+		modify  func(w *WebAuthn, resp *AssertionResponse)
+		reason  string
+	}{
+		{"tampered signature", "assertion-es256", 0, func(_ *WebAuthn, resp *AssertionResponse) {
+			sig, _ := decodeBase64URL(resp.Response.Signature)
+			sig[len(sig)-1] ^= 0x01
+			resp.Response.Signature = encodeBase64URL(sig)
+		}, "signature"},
+		{"wrong origin", "assertion-es256", 0, func(w *WebAuthn, _ *AssertionResponse) { w.opts.Origins = []string{"https://evil.example"} }, "origin not allowed"},
+		{"wrong rp id", "assertion-es256", 0, func(w *WebAuthn, _ *AssertionResponse) { w.opts.RPID = "example.com" }, "rp id mismatch"},
+		{"counter replay", "assertion-es256", 5, func(*WebAuthn, *AssertionResponse) {}, "sign count did not increase"},
+		{"counter regression", "assertion-es256", 9, func(*WebAuthn, *AssertionResponse) {}, "sign count did not increase"},
+		// A clone reporting no counter for a credential whose counter was seen
+		{"counter reset to zero", "assertion-eddsa", 7, func(*WebAuthn, *AssertionResponse) {}, "sign count did not increase"},
+		{"unknown credential", "assertion-es256", 0, func(_ *WebAuthn, resp *AssertionResponse) { resp.RawID = encodeBase64URL([]byte("other")) }, "unknown credential"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := loadWebAuthnFixture(t, tt.fixture)
+			w, resp := f.webauthn(nil), f.assertion(t)
+			tt.modify(w, resp)
+			_, err := w.VerifyAssertion(f.challenge(t), f.user(t, tt.stored), resp)
+			if reason := webauthnReason(err); reason != tt.reason {
+				t.Errorf("error = %v (%q), want reason %q", err, reason, tt.reason)
+			}
+		})
+	}
+}
+
+// challengeCache emulates the Redis commands used for WebAuthn challenges
+type challengeCache struct {
+	cache.Cache
+	values map[string]string
+}
+
+func (c *challengeCache) Set(_ context.Context, key string, value interface{}, _ time.Duration) error {
+	c.values[key] = value.(string)
+	return nil
+}
+
+func (c *challengeCache) Eval(_ context.Context, script string, keys []string, _ ...interface{}) (interface{}, error) {
+	if script != webauthnConsumeScript {
+		panic("unexpected script")
+	}
+	v, ok := c.values[keys[0]]
+	if !ok {
+		return nil, redis.Nil
+	}
+	delete(c.values, keys[0])
+	return v, nil
+}
+
+func TestFinishLoginConsumesChallenge(t *testing.T) {
+	f := loadWebAuthnFixture(t, "assertion-es256")
+	c := &challengeCache{values: map[string]string{}}
+	w := f.webauthn(c)
+	user := f.user(t, 0)
+
+	session, _ := json.Marshal(&webauthnSession{UserID: user.ID, AllowCredentials: [][]byte{user.Credentials[0].ID}})
+	c.values[webauthnSessionPrefix+f.Challenge] = string(session)
+
+	if _, err := w.FinishLogin(context.Background(), user, f.assertion(t)); err != nil {
+		t.Fatalf("FinishLogin: %v (%s)", err, webauthnReason(err))
+	}
+	_, err := w.FinishLogin(context.Background(), user, f.assertion(t))
+	if reason := webauthnReason(err); reason != "challenge expired" {
+		t.Errorf("second FinishLogin error = %v (%q), want challenge expired", err, reason)
+	}
+}
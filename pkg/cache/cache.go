@@ -28,6 +28,12 @@ type Cache interface {
 	Close() error
 }
 
+// IsMiss reports whether err means the key does not exist.
+// Both RedisCache (redis.Nil) and RistrettoCache ("redis: nil") are recognised.
+func IsMiss(err error) bool {
+	return err != nil && (err == redis.Nil || err.Error() == redis.Nil.Error())
+}
+
 // RedisCache implements Cache using Redis
 type RedisCache struct {
 	client *redis.Client
@@ -92,6 +98,18 @@ func (c *RedisCache) SIsMember(ctx context.Context, key string, member interface
 	return c.client.SIsMember(ctx, key, member).Result()
 }
 
+func (c *RedisCache) SMembers(ctx context.Context, key string) ([]string, error) {
+	return c.client.SMembers(ctx, key).Result()
+}
+
+func (c *RedisCache) SRem(ctx context.Context, key string, members ...interface{}) error {
+	return c.client.SRem(ctx, key, members...).Err()
+}
+
+func (c *RedisCache) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return c.client.Expire(ctx, key, expiration).Err()
+}
+
 func (c *RedisCache) Close() error {
 	return c.client.Close()
 }
@@ -24,6 +24,16 @@ func NewHybridCache(local Cache, remote Cache) *HybridCache {
 	}
 }
 
+// Local returns the L1 cache
+func (c *HybridCache) Local() Cache {
+	return c.local
+}
+
+// Remote returns the L2 cache
+func (c *HybridCache) Remote() Cache {
+	return c.remote
+}
+
 func (c *HybridCache) Get(ctx context.Context, key string) (string, error) {
 	// 1. Try L1
 	val, err := c.local.Get(ctx, key)
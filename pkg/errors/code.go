@@ -62,7 +62,7 @@ func (e *customError) GRPCStatus() *status.Status {
 		c = codes.NotFound
 	case http.StatusConflict:
 		c = codes.AlreadyExists
-	case http.StatusTooManyRequests:
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
 		c = codes.ResourceExhausted
 	case http.StatusInternalServerError:
 		c = codes.Internal
@@ -76,6 +76,41 @@ func (e *customError) GRPCStatus() *status.Status {
 	return status.New(c, e.message)
 }
 
+// detailedError is a coded error carrying structured details for the client
+type detailedError struct {
+	ErrorCode
+	details interface{}
+}
+
+// WithDetails attaches details to a coded error. response.Error sends them as data.
+func WithDetails(err ErrorCode, details interface{}) ErrorCode {
+	return &detailedError{ErrorCode: err, details: details}
+}
+
+func (e *detailedError) Details() interface{} {
+	return e.details
+}
+
+func (e *detailedError) Unwrap() error {
+	return e.ErrorCode
+}
+
+func (e *detailedError) GRPCStatus() *status.Status {
+	if s, ok := e.ErrorCode.(interface{ GRPCStatus() *status.Status }); ok {
+		return s.GRPCStatus()
+	}
+	return status.New(codes.Unknown, e.Message())
+}
+
+// Details returns the details of an error created by WithDetails (or any error
+// with a Details method), nil otherwise
+func Details(err error) interface{} {
+	if d, ok := err.(interface{ Details() interface{} }); ok {
+		return d.Details()
+	}
+	return nil
+}
+
 // Common Errors
 var (
 	Success             = New(http.StatusOK, 0, "success")
@@ -91,9 +126,27 @@ var (
 	ErrPasswordIncorrect  = New(http.StatusUnauthorized, 20002, "password incorrect")
 	ErrTokenInvalid       = New(http.StatusUnauthorized, 20003, "token invalid")
 	ErrTokenExpired       = New(http.StatusUnauthorized, 20004, "token expired")
+	ErrTokenRevoked       = New(http.StatusUnauthorized, 20005, "token revoked")
+	ErrRefreshInvalid     = New(http.StatusUnauthorized, 20006, "refresh token invalid")
+	ErrRefreshReused      = New(http.StatusUnauthorized, 20007, "refresh token reused")
+	ErrSignatureInvalid   = New(http.StatusUnauthorized, 20008, "signature invalid")
+	ErrRequestTimeSkewed  = New(http.StatusUnauthorized, 20009, "request time skewed")
+	ErrRequestReplayed    = New(http.StatusUnauthorized, 20010, "request replayed")
+	ErrPresignExpired     = New(http.StatusForbidden, 20011, "presigned url expired")
+	ErrContentHashInvalid = New(http.StatusBadRequest, 20012, "content sha256 mismatch")
+	ErrPasswordPolicy     = New(http.StatusBadRequest, 20013, "password does not meet policy")
+	ErrPasswordMustChange = New(http.StatusForbidden, 20014, "password change required")
+	ErrPasswordTooRecent  = New(http.StatusBadRequest, 20015, "password changed too recently")
+	ErrPasswordReused     = New(http.StatusBadRequest, 20016, "password used recently")
+	ErrMFAEnrollment      = New(http.StatusBadRequest, 20017, "mfa enrollment not found or expired")
+	ErrMFACodeInvalid     = New(http.StatusUnauthorized, 20018, "mfa code invalid")
+	ErrWebAuthnInvalid    = New(http.StatusUnauthorized, 20019, "webauthn verification failed")
+	ErrVerifyCodeInvalid  = New(http.StatusBadRequest, 20020, "verification code invalid or expired")
+	ErrSessionInvalid     = New(http.StatusUnauthorized, 20021, "session expired or revoked")
 	ErrUserAlreadyExists  = New(409, 20409, "User already exists")
 	ErrInvalidCredentials = New(401, 20401, "Invalid credentials")
 	ErrMFARequired        = New(403, 20403, "MFA required")
 	ErrPasswordExpired    = New(403, 20404, "Password expired")
 	ErrForbidden          = New(http.StatusForbidden, 10007, "forbidden")
+	ErrRequestTooLarge    = New(http.StatusRequestEntityTooLarge, 10008, "request body too large")
 )
@@ -0,0 +1,312 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/auth"
+	"github.com/arrow2012/nuwa-kit/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Metadata keys (gRPC metadata keys are lower case)
+const (
+	MetadataAuthorization  = "authorization"
+	MetadataNuwaDate       = "x-nuwa-date"
+	MetadataNuwaNonce      = "x-nuwa-nonce"
+	MetadataSignedMetadata = "x-nuwa-signed-metadata" // Names of the signed metadata joined by ';'
+)
+
+// AuthConfig configures the server auth interceptors.
+// At least one of Verifier (bearer tokens) or AccessKeys (HMAC) must be set.
+type AuthConfig struct {
+	Verifier   *auth.TokenVerifier
+	AccessKeys auth.AccessKeyStore
+
+	// MaxSkew bounds the x-nuwa-date of HMAC-signed calls. Defaults to auth.DefaultMaxSkew, as over HTTP.
+	MaxSkew time.Duration
+
+	// Nonces enables replay protection for HMAC-signed calls carrying x-nuwa-nonce
+	Nonces *auth.NonceStore
+	// RequireNonce rejects HMAC-signed calls without x-nuwa-nonce (needs Nonces)
+	RequireNonce bool
+
+	// PublicMethods skip authentication. Entries are full method names
+	// ("/pkg.Service/Method") or service prefixes ending with "/" ("/grpc.health.v1.Health/").
+	PublicMethods []string
+
+	// Skip is consulted after PublicMethods for dynamic rules
+	Skip func(ctx context.Context, fullMethod string) bool
+}
+
+// UnaryServerAuth authenticates unary calls and puts the identity into the context
+func UnaryServerAuth(cfg AuthConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if cfg.skip(ctx, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, err := cfg.authenticate(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerAuth authenticates streaming calls and puts the identity into the stream context
+func StreamServerAuth(cfg AuthConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if cfg.skip(ss.Context(), info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, err := cfg.authenticate(ss.Context(), info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (cfg AuthConfig) skip(ctx context.Context, fullMethod string) bool {
+	for _, m := range cfg.PublicMethods {
+		if m == fullMethod || (strings.HasSuffix(m, "/") && strings.HasPrefix(fullMethod, m)) {
+			return true
+		}
+	}
+	return cfg.Skip != nil && cfg.Skip(ctx, fullMethod)
+}
+
+// authenticate returns errors from the errors package, they carry their own gRPC status.
+// req is the request of unary calls, nil for streams whose messages are not signed.
+func (cfg AuthConfig) authenticate(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := first(md, MetadataAuthorization)
+	if authorization == "" {
+		return nil, errors.ErrUnauthorized
+	}
+
+	scheme, value, _ := strings.Cut(authorization, " ")
+	switch {
+	case strings.EqualFold(scheme, "Bearer") && cfg.Verifier != nil:
+		claims, err := cfg.Verifier.Verify(ctx, strings.TrimSpace(value))
+		if err != nil {
+			if _, ok := err.(errors.ErrorCode); !ok {
+				err = errors.ErrTokenInvalid
+			}
+			return nil, err
+		}
+		return auth.WithClaims(ctx, claims), nil
+
+	case scheme == "Nuwa" && cfg.AccessKeys != nil:
+		return cfg.authenticateHMAC(ctx, md, authorization, fullMethod, req)
+
+	default:
+		return nil, errors.ErrUnauthorized
+	}
+}
+
+// authenticateHMAC returns errors.ErrSignatureInvalid, ErrRequestTimeSkewed or
+// ErrRequestReplayed for bad calls, ErrInvalidCredentials for unknown or disabled keys
+func (cfg AuthConfig) authenticateHMAC(ctx context.Context, md metadata.MD, authorization, fullMethod string, req interface{}) (context.Context, error) {
+	accessKey, signature, err := auth.ParseAuthorization(authorization)
+	if err != nil {
+		return nil, errors.ErrSignatureInvalid
+	}
+
+	call := &auth.GRPCCall{
+		FullMethod:  fullMethod,
+		Date:        first(md, MetadataNuwaDate),
+		Nonce:       first(md, MetadataNuwaNonce),
+		PayloadHash: auth.UnsignedPayload,
+	}
+	signedAt, err := time.Parse(time.RFC3339, call.Date)
+	if err != nil {
+		return nil, errors.ErrSignatureInvalid
+	}
+	maxSkew := cfg.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = auth.DefaultMaxSkew
+	}
+	if skew := time.Since(signedAt); skew > maxSkew || skew < -maxSkew {
+		return nil, errors.ErrRequestTimeSkewed
+	}
+	if req != nil {
+		if call.PayloadHash, err = payloadHash(req); err != nil {
+			return nil, errors.ErrSignatureInvalid
+		}
+	}
+	call.Metadata, err = signedMetadata(md, strings.Split(first(md, MetadataSignedMetadata), ";"))
+	if err != nil {
+		return nil, errors.ErrSignatureInvalid
+	}
+
+	key, err := cfg.AccessKeys.GetAccessKey(ctx, accessKey)
+	if err != nil || key == nil || key.Disabled {
+		return nil, errors.ErrInvalidCredentials
+	}
+	if !auth.VerifyGRPCSignature(key.SecretKey, call, signature) {
+		return nil, errors.ErrSignatureInvalid
+	}
+
+	// Only record nonces of authentic calls, so they cannot be burnt by others
+	if cfg.Nonces != nil {
+		if call.Nonce == "" {
+			if cfg.RequireNonce {
+				return nil, errors.ErrSignatureInvalid
+			}
+		} else if fresh, err := cfg.Nonces.Use(ctx, accessKey, call.Nonce, 2*maxSkew); err != nil {
+			return nil, err
+		} else if !fresh {
+			return nil, errors.ErrRequestReplayed
+		}
+	}
+	return auth.WithAccessKey(ctx, key), nil
+}
+
+// payloadHash is the hex SHA-256 of the deterministic protobuf encoding of req
+func payloadHash(req interface{}) (string, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return "", fmt.Errorf("cannot sign %T: not a proto message", req)
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// signedMetadata picks the named metadata. The signature metadata itself cannot be signed.
+func signedMetadata(md metadata.MD, names []string) (map[string][]string, error) {
+	signed := make(map[string][]string, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+			continue
+		case MetadataAuthorization, MetadataNuwaDate, MetadataNuwaNonce, MetadataSignedMetadata:
+			return nil, fmt.Errorf("metadata %q cannot be signed", name)
+		}
+		signed[name] = md.Get(name)
+	}
+	return signed, nil
+}
+
+// TokenSource returns the bearer token to attach to outgoing calls
+type TokenSource func(ctx context.Context) (string, error)
+
+// UnaryClientBearer attaches "authorization: Bearer <token>" to unary calls
+func UnaryClientBearer(source TokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := withBearer(ctx, source)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientBearer attaches "authorization: Bearer <token>" to streaming calls
+func StreamClientBearer(source TokenSource) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := withBearer(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// UnaryClientHMAC signs unary calls with an access key pair: the method, the request
+// message, a nonce and the outgoing metadata named in signedMetadata
+func UnaryClientHMAC(accessKey, secretKey string, signedMetadata ...string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		hash, err := payloadHash(req)
+		if err != nil {
+			return err
+		}
+		ctx, err = withHMAC(ctx, accessKey, secretKey, method, hash, signedMetadata)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientHMAC signs streaming calls with an access key pair.
+// Stream messages are not signed, only the method, a nonce and the named metadata.
+func StreamClientHMAC(accessKey, secretKey string, signedMetadata ...string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := withHMAC(ctx, accessKey, secretKey, method, auth.UnsignedPayload, signedMetadata)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func withBearer(ctx context.Context, source TokenSource) (context.Context, error) {
+	token, err := source(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, MetadataAuthorization, "Bearer "+token), nil
+}
+
+func withHMAC(ctx context.Context, accessKey, secretKey, method, payloadHash string, names []string) (context.Context, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	signed, err := signedMetadata(md, names)
+	if err != nil {
+		return nil, err
+	}
+	call := &auth.GRPCCall{
+		FullMethod:  method,
+		Date:        time.Now().UTC().Format(time.RFC3339),
+		Nonce:       hex.EncodeToString(nonce),
+		Metadata:    signed,
+		PayloadHash: payloadHash,
+	}
+
+	kv := []string{
+		MetadataNuwaDate, call.Date,
+		MetadataNuwaNonce, call.Nonce,
+		MetadataAuthorization, auth.SignGRPC(accessKey, secretKey, call),
+	}
+	if len(signed) > 0 {
+		keys := make([]string, 0, len(signed))
+		for name := range signed {
+			keys = append(keys, name)
+		}
+		kv = append(kv, MetadataSignedMetadata, strings.Join(keys, ";"))
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...), nil
+}
+
+func first(md metadata.MD, key string) string {
+	if vals := md.Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// wrappedStream overrides the context of a grpc.ServerStream
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context {
+	return w.ctx
+}
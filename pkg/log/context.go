@@ -2,6 +2,7 @@ package log
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/arrow2012/nuwa-kit/pkg/auth"
 	"go.uber.org/zap"
@@ -23,19 +24,9 @@ func C(ctx context.Context) *zap.Logger {
 		}
 	}
 
-	// UserID
-	if userID, exists := auth.UserIDFromContext(ctx); exists {
-		fields = append(fields, zap.Int("user_id", userID))
-	}
-
-	// Username
-	if username, exists := auth.UsernameFromContext(ctx); exists {
-		fields = append(fields, zap.String("username", username))
-	}
-
-	// TenantID
-	if tenantID, exists := auth.TenantIDFromContext(ctx); exists {
-		fields = append(fields, zap.Int("tenant_id", tenantID))
+	// Principal (user, tenant, role, session, client)
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		fields = append(fields, principalFields(p)...)
 	}
 
 	if len(fields) > 0 {
@@ -45,6 +36,36 @@ func C(ctx context.Context) *zap.Logger {
 	return logger
 }
 
+// principalFields logs the non-empty principal IDs.
+// Numeric IDs stay numbers, as before Principal had string IDs.
+func principalFields(p *auth.Principal) []zap.Field {
+	var fields []zap.Field
+	id := func(key, v string) {
+		if v == "" {
+			return
+		}
+		if n, err := strconv.Atoi(v); err == nil {
+			fields = append(fields, zap.Int(key, n))
+		} else {
+			fields = append(fields, zap.String(key, v))
+		}
+	}
+
+	id("user_id", p.UserID)
+	if p.Username != "" {
+		fields = append(fields, zap.String("username", p.Username))
+	}
+	id("tenant_id", p.TenantID)
+	id("role_id", p.RoleID) // STS sessions
+	if p.SessionID != "" {
+		fields = append(fields, zap.String("session_id", p.SessionID))
+	}
+	if p.ClientID != "" {
+		fields = append(fields, zap.String("client_id", p.ClientID))
+	}
+	return fields
+}
+
 // CInfo logs a message with context fields
 func CInfo(ctx context.Context, msg string, fields ...zap.Field) {
 	C(ctx).Info(msg, fields...)
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/arrow2012/nuwa-kit/pkg/auth"
+	"github.com/arrow2012/nuwa-kit/pkg/response"
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderPasswordStatus tells clients that the password expires soon ("warn")
+const HeaderPasswordStatus = "X-Nuwa-Password-Status"
+
+// RequirePasswordCurrent rejects requests whose token was issued with an expired or
+// must-change password status (auth.WithPasswordStatus, or RefreshManager.SetPasswordStatus
+// for refreshed tokens), except on allowPaths (gin FullPath),
+// typically the change password and logout routes. Must run after JWTAuth.
+func RequirePasswordCurrent(allowPaths ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(allowPaths))
+	for _, p := range allowPaths {
+		allowed[p] = true
+	}
+
+	return func(c *gin.Context) {
+		claims, ok := ClaimsFromGin(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		status := auth.PasswordStatusFromClaims(claims)
+		if status == auth.PasswordStatusWarn {
+			c.Header(HeaderPasswordStatus, string(status))
+		}
+		if err := status.Err(); err != nil && !allowed[c.FullPath()] {
+			response.Error(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/arrow2012/nuwa-kit/pkg/auth"
+	"github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/response"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireStepUp rejects requests unless the caller authenticated with all the methods
+// (auth.AuthMethod*) within maxAge, 0 for any age, e.g. RequireStepUp(5*time.Minute, auth.AuthMethodMFA)
+// for key deletion. Failures are errors.ErrMFARequired with an auth.StepUpChallenge as data
+// and an RFC 9470 WWW-Authenticate header. Must run after JWTAuth.
+func RequireStepUp(maxAge time.Duration, methods ...string) gin.HandlerFunc {
+	challenge := `Bearer error="insufficient_user_authentication"`
+	if maxAge > 0 {
+		challenge += fmt.Sprintf(", max_age=%d", int64(maxAge/time.Second))
+	}
+
+	return func(c *gin.Context) {
+		if err := auth.RequireStepUp(c.Request.Context(), maxAge, methods...); err != nil {
+			if err != errors.ErrUnauthorized {
+				c.Header("WWW-Authenticate", challenge)
+			}
+			response.Error(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,124 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/arrow2012/nuwa-kit/pkg/auth"
+	"github.com/arrow2012/nuwa-kit/pkg/json"
+)
+
+// BuildInput builds the standard policy input from verified token claims:
+//
+//	{
+//	  "subject":  {"user_id", "username", "tenant_id", "role_id", "mfa", "scopes",
+//	               "auth_methods", "auth_time", "session_id", "client_id"},
+//	  "action":   "...",
+//	  "resource": "...",
+//	  "session":  {"policy": {...}, "tags": {...}}   // STS sessions only
+//	}
+//
+// For assumed-role sessions the policy should allow only what both the role
+// and the session policy allow, like AWS AssumeRole:
+//
+//	import rego.v1
+//
+//	allow if {
+//	    role_allows
+//	    session_allows
+//	}
+//
+//	session_allows if not input.session.policy
+//	session_allows if {
+//	    some stmt in input.session.policy.Statement
+//	    stmt.Effect == "Allow"
+//	    input.action in stmt.Action
+//	}
+//
+// The subject is the auth.Principal of the claims. Numeric IDs are numbers as before
+// the principal had string IDs (0 when unknown), other IDs (UUIDs) are strings.
+func BuildInput(claims *auth.Claims, action, resource string) (map[string]interface{}, error) {
+	if claims == nil {
+		return nil, errors.New("claims are required")
+	}
+
+	input := BuildPrincipalInput(auth.PrincipalFromClaims(claims), action, resource)
+
+	if claims.SessionPolicy != "" || len(claims.SessionTags) > 0 {
+		session := map[string]interface{}{}
+		if claims.SessionPolicy != "" {
+			var policy map[string]interface{}
+			if err := json.Unmarshal([]byte(claims.SessionPolicy), &policy); err != nil {
+				return nil, fmt.Errorf("invalid session policy: %w", err)
+			}
+			session["policy"] = policy
+		}
+		if len(claims.SessionTags) > 0 {
+			tags := make(map[string]interface{}, len(claims.SessionTags))
+			for k, v := range claims.SessionTags {
+				tags[k] = v
+			}
+			session["tags"] = tags
+		}
+		input["session"] = session
+	}
+
+	return input, nil
+}
+
+// BuildPrincipalInput builds the policy input of a principal, without session section
+func BuildPrincipalInput(p *auth.Principal, action, resource string) map[string]interface{} {
+	scopes := p.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	methods := p.AuthMethods
+	if methods == nil {
+		methods = []string{}
+	}
+	var authTime int64 // Unix seconds, 0 if unknown
+	if !p.AuthTime.IsZero() {
+		authTime = p.AuthTime.Unix()
+	}
+	return map[string]interface{}{
+		"subject": map[string]interface{}{
+			"user_id":      subjectID(p.UserID),
+			"username":     p.Username,
+			"tenant_id":    subjectID(p.TenantID),
+			"role_id":      subjectID(p.RoleID),
+			"mfa":          p.MFA,
+			"scopes":       scopes,
+			"auth_methods": methods,
+			"auth_time":    authTime,
+			"session_id":   p.SessionID,
+			"client_id":    p.ClientID,
+		},
+		"action":   action,
+		"resource": resource,
+	}
+}
+
+// subjectID keeps numeric IDs numeric, so that policies comparing them to numbers still match
+func subjectID(id string) interface{} {
+	if id == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(id); err == nil {
+		return n
+	}
+	return id
+}
+
+// BuildInputFromContext is BuildInput with the claims stored by the auth middleware,
+// or BuildPrincipalInput when only a principal was stored
+func BuildInputFromContext(ctx context.Context, action, resource string) (map[string]interface{}, error) {
+	if claims, ok := auth.ClaimsFromContext(ctx); ok {
+		return BuildInput(claims, action, resource)
+	}
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		return BuildPrincipalInput(p, action, resource), nil
+	}
+	return nil, errors.New("no principal in context")
+}
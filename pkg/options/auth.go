@@ -10,10 +10,14 @@ type AuthOptions struct {
 	JWTSecret         string        `json:"jwtSecret" mapstructure:"jwtSecret"`
 	EncryptionKey     string        `json:"encryptionKey" mapstructure:"encryptionKey"` // 32 bytes for AES-256
 	TokenDuration     time.Duration `json:"tokenDuration" mapstructure:"tokenDuration"`
+	RefreshDuration   time.Duration `json:"refreshDuration" mapstructure:"refreshDuration"`
 	SendCodeRateLimit time.Duration `json:"sendCodeRateLimit" mapstructure:"sendCodeRateLimit"`
 	Issuer            string        `json:"issuer" mapstructure:"issuer"`
+	Audience          []string      `json:"audience" mapstructure:"audience"`
+	Leeway            time.Duration `json:"leeway" mapstructure:"leeway"` // Clock skew tolerated when verifying tokens
 	PrivateKey        string        `json:"privateKey" mapstructure:"privateKey"`
 	PublicKey         string        `json:"publicKey" mapstructure:"publicKey"`
+	JWKSURL           string        `json:"jwksURL" mapstructure:"jwksURL"` // Remote JWKS, preferred over PublicKey for verification (auth.KeySetFromOptions)
 }
 
 // NewServerOptions create a `zero` value instance.
@@ -22,8 +26,10 @@ func NewAuthOptions() *AuthOptions {
 		JWTSecret:         "1234567890",
 		EncryptionKey:     "12345678901234567890123456789012", // Default 32 bytes key for dev
 		TokenDuration:     24 * time.Hour,
+		RefreshDuration:   30 * 24 * time.Hour,
 		SendCodeRateLimit: 1 * time.Minute,
 		Issuer:            "http://localhost:8080",
+		Leeway:            30 * time.Second,
 	}
 }
 
@@ -38,9 +44,12 @@ func (o *AuthOptions) Complete() {
 			o.EncryptionKey = "12345678901234567890123456789012"
 		}
 	}
-	if o.TokenDuration < 1*time.Hour {
+	if o.TokenDuration <= 0 {
 		o.TokenDuration = 24 * time.Hour
 	}
+	if o.RefreshDuration <= 0 {
+		o.RefreshDuration = 30 * 24 * time.Hour
+	}
 	if o.SendCodeRateLimit <= 0 {
 		o.SendCodeRateLimit = 1 * time.Minute
 	}
@@ -59,9 +68,15 @@ func (o *AuthOptions) Validate() []error {
 	if len(o.EncryptionKey) != 32 {
 		errs = append(errs, fmt.Errorf("encryptionKey must be exactly 32 bytes"))
 	}
+	if o.Leeway < 0 {
+		errs = append(errs, fmt.Errorf("leeway cannot be negative"))
+	}
 	if o.TokenDuration <= 0 {
 		errs = append(errs, fmt.Errorf("tokenDuration must be greater than 0"))
 	}
+	if o.RefreshDuration > 0 && o.RefreshDuration <= o.TokenDuration {
+		errs = append(errs, fmt.Errorf("refreshDuration must be greater than tokenDuration"))
+	}
 	return errs
 }
 
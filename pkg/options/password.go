@@ -0,0 +1,184 @@
+package options
+
+import (
+	"fmt"
+	"time"
+)
+
+// PasswordOptions contains password hashing configuration
+type PasswordOptions struct {
+	// Algorithm used for new hashes: argon2id or bcrypt. Both are accepted when verifying.
+	Algorithm string `json:"algorithm" mapstructure:"algorithm"`
+
+	BcryptCost int `json:"bcryptCost" mapstructure:"bcryptCost"`
+
+	Argon2Memory      uint32 `json:"argon2Memory" mapstructure:"argon2Memory"` // KiB
+	Argon2Iterations  uint32 `json:"argon2Iterations" mapstructure:"argon2Iterations"`
+	Argon2Parallelism uint8  `json:"argon2Parallelism" mapstructure:"argon2Parallelism"`
+	Argon2SaltLength  uint32 `json:"argon2SaltLength" mapstructure:"argon2SaltLength"`
+	Argon2KeyLength   uint32 `json:"argon2KeyLength" mapstructure:"argon2KeyLength"`
+
+	// Policy applies to tenants without an entry in TenantPolicies
+	Policy PasswordPolicyOptions `json:"policy" mapstructure:"policy"`
+	// TenantPolicies replaces Policy for a tenant, keyed by tenant ID
+	TenantPolicies map[string]PasswordPolicyOptions `json:"tenantPolicies" mapstructure:"tenantPolicies"`
+
+	// BreachFile is a local Have I Been Pwned SHA-1 dump (sorted HASH:COUNT lines),
+	// a binary index built from it, or a directory of the range dump (5 characters
+	// prefix files of SUFFIX:COUNT lines), used by policies with a breachThreshold
+	BreachFile string `json:"breachFile" mapstructure:"breachFile"`
+
+	Lifecycle PasswordLifecycleOptions `json:"lifecycle" mapstructure:"lifecycle"`
+}
+
+// PasswordLifecycleOptions contains password rotation rules, zero values disable a rule
+type PasswordLifecycleOptions struct {
+	MaxAge time.Duration `json:"maxAge" mapstructure:"maxAge"`
+	// WarnBefore is the window before MaxAge in which users are asked to change their password
+	WarnBefore time.Duration `json:"warnBefore" mapstructure:"warnBefore"`
+	// MinAge is the minimum time between two changes, so history cannot be cycled through
+	MinAge time.Duration `json:"minAge" mapstructure:"minAge"`
+	// HistoryDepth is the number of previous passwords that cannot be reused
+	HistoryDepth int `json:"historyDepth" mapstructure:"historyDepth"`
+	// ForceChangeOnFirstLogin requires users to replace the password they were given
+	ForceChangeOnFirstLogin bool `json:"forceChangeOnFirstLogin" mapstructure:"forceChangeOnFirstLogin"`
+}
+
+// PasswordPolicyOptions contains password complexity rules, zero values disable a rule
+type PasswordPolicyOptions struct {
+	MinLength int `json:"minLength" mapstructure:"minLength"` // In characters
+	MaxLength int `json:"maxLength" mapstructure:"maxLength"`
+
+	RequireUpper   bool `json:"requireUpper" mapstructure:"requireUpper"`
+	RequireLower   bool `json:"requireLower" mapstructure:"requireLower"`
+	RequireDigit   bool `json:"requireDigit" mapstructure:"requireDigit"`
+	RequireSpecial bool `json:"requireSpecial" mapstructure:"requireSpecial"`
+	// MinCharClasses requires this many of upper/lower/digit/special, e.g. 3 for "3 of 4"
+	MinCharClasses int `json:"minCharClasses" mapstructure:"minCharClasses"`
+
+	// MaxRepeated limits runs of the same character, e.g. 2 rejects "aaa"
+	MaxRepeated int `json:"maxRepeated" mapstructure:"maxRepeated"`
+
+	// DisallowUserInfo rejects passwords containing the username or the email local part
+	DisallowUserInfo bool `json:"disallowUserInfo" mapstructure:"disallowUserInfo"`
+
+	// Blocklist and BlocklistFile (one password per line) list forbidden passwords, case-insensitive
+	Blocklist     []string `json:"blocklist" mapstructure:"blocklist"`
+	BlocklistFile string   `json:"blocklistFile" mapstructure:"blocklistFile"`
+
+	// MinEntropy is the minimum estimated entropy in bits
+	MinEntropy float64 `json:"minEntropy" mapstructure:"minEntropy"`
+
+	// BreachThreshold rejects passwords found this many times in PasswordOptions.BreachFile
+	BreachThreshold int `json:"breachThreshold" mapstructure:"breachThreshold"`
+}
+
+// NewPasswordOptions create a `zero` value instance.
+// Argon2id defaults follow the OWASP recommendation (19 MiB, 2 iterations, 1 lane).
+func NewPasswordOptions() *PasswordOptions {
+	return &PasswordOptions{
+		Algorithm:         "argon2id",
+		BcryptCost:        12,
+		Argon2Memory:      19 * 1024,
+		Argon2Iterations:  2,
+		Argon2Parallelism: 1,
+		Argon2SaltLength:  16,
+		Argon2KeyLength:   32,
+		Policy: PasswordPolicyOptions{
+			MinLength:      8,
+			MaxLength:      128,
+			RequireUpper:   true,
+			RequireLower:   true,
+			RequireDigit:   true,
+			RequireSpecial: true,
+		},
+		Lifecycle: PasswordLifecycleOptions{
+			HistoryDepth: 5,
+		},
+	}
+}
+
+// Complete sets default values for PasswordOptions.
+func (o *PasswordOptions) Complete() {
+	defaults := NewPasswordOptions()
+	if o.Algorithm == "" {
+		o.Algorithm = defaults.Algorithm
+	}
+	if o.BcryptCost == 0 {
+		o.BcryptCost = defaults.BcryptCost
+	}
+	if o.Argon2Memory == 0 {
+		o.Argon2Memory = defaults.Argon2Memory
+	}
+	if o.Argon2Iterations == 0 {
+		o.Argon2Iterations = defaults.Argon2Iterations
+	}
+	if o.Argon2Parallelism == 0 {
+		o.Argon2Parallelism = defaults.Argon2Parallelism
+	}
+	if o.Argon2SaltLength == 0 {
+		o.Argon2SaltLength = defaults.Argon2SaltLength
+	}
+	if o.Argon2KeyLength == 0 {
+		o.Argon2KeyLength = defaults.Argon2KeyLength
+	}
+	if o.Policy.MinLength == 0 {
+		o.Policy.MinLength = defaults.Policy.MinLength
+	}
+}
+
+// Validate verifies flags passed to PasswordOptions.
+func (o *PasswordOptions) Validate() []error {
+	errs := []error{}
+
+	if o.Algorithm != "argon2id" && o.Algorithm != "bcrypt" {
+		errs = append(errs, fmt.Errorf("algorithm must be argon2id or bcrypt"))
+	}
+	if o.BcryptCost < 10 || o.BcryptCost > 31 {
+		errs = append(errs, fmt.Errorf("bcryptCost must be between 10 and 31"))
+	}
+	if o.Argon2Memory < 8*uint32(o.Argon2Parallelism) {
+		errs = append(errs, fmt.Errorf("argon2Memory must be at least 8 KiB per lane"))
+	}
+	if o.Argon2Iterations < 1 {
+		errs = append(errs, fmt.Errorf("argon2Iterations must be at least 1"))
+	}
+	if o.Argon2Parallelism < 1 {
+		errs = append(errs, fmt.Errorf("argon2Parallelism must be at least 1"))
+	}
+	if o.Argon2SaltLength < 8 {
+		errs = append(errs, fmt.Errorf("argon2SaltLength must be at least 8 bytes"))
+	}
+	if o.Argon2KeyLength < 16 {
+		errs = append(errs, fmt.Errorf("argon2KeyLength must be at least 16 bytes"))
+	}
+
+	if o.Lifecycle.MaxAge < 0 || o.Lifecycle.WarnBefore < 0 || o.Lifecycle.MinAge < 0 || o.Lifecycle.HistoryDepth < 0 {
+		errs = append(errs, fmt.Errorf("lifecycle: limits cannot be negative"))
+	}
+	if o.Lifecycle.MaxAge > 0 && (o.Lifecycle.WarnBefore >= o.Lifecycle.MaxAge || o.Lifecycle.MinAge >= o.Lifecycle.MaxAge) {
+		errs = append(errs, fmt.Errorf("lifecycle: warnBefore and minAge must be less than maxAge"))
+	}
+
+	errs = append(errs, o.Policy.Validate("policy")...)
+	for tenant, policy := range o.TenantPolicies {
+		errs = append(errs, policy.Validate("tenantPolicies."+tenant)...)
+	}
+	return errs
+}
+
+// Validate verifies a password policy, errors are prefixed with name
+func (o *PasswordPolicyOptions) Validate(name string) []error {
+	errs := []error{}
+
+	if o.MinLength < 0 || o.MaxLength < 0 || o.MaxRepeated < 0 || o.MinEntropy < 0 || o.BreachThreshold < 0 {
+		errs = append(errs, fmt.Errorf("%s: limits cannot be negative", name))
+	}
+	if o.MaxLength > 0 && o.MaxLength < o.MinLength {
+		errs = append(errs, fmt.Errorf("%s: maxLength must not be less than minLength", name))
+	}
+	if o.MinCharClasses < 0 || o.MinCharClasses > 4 {
+		errs = append(errs, fmt.Errorf("%s: minCharClasses must be between 0 and 4", name))
+	}
+	return errs
+}
@@ -0,0 +1,38 @@
+package options
+
+import (
+	"fmt"
+	"time"
+)
+
+// SessionOptions contains server-side session configuration
+type SessionOptions struct {
+	IdleTimeout     time.Duration `json:"idleTimeout" mapstructure:"idleTimeout"`         // Sliding expiration
+	AbsoluteTimeout time.Duration `json:"absoluteTimeout" mapstructure:"absoluteTimeout"` // Since creation, regardless of activity
+	TouchInterval   time.Duration `json:"touchInterval" mapstructure:"touchInterval"`     // Minimum time between last-seen updates
+}
+
+// NewSessionOptions create a `zero` value instance.
+func NewSessionOptions() *SessionOptions {
+	return &SessionOptions{
+		IdleTimeout:     7 * 24 * time.Hour,
+		AbsoluteTimeout: 30 * 24 * time.Hour,
+		TouchInterval:   1 * time.Minute,
+	}
+}
+
+// Validate verifies flags passed to SessionOptions.
+func (o *SessionOptions) Validate() []error {
+	errs := []error{}
+
+	if o.IdleTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("idleTimeout must be greater than 0"))
+	}
+	if o.AbsoluteTimeout < o.IdleTimeout {
+		errs = append(errs, fmt.Errorf("absoluteTimeout cannot be shorter than idleTimeout"))
+	}
+	if o.TouchInterval < 0 || o.TouchInterval >= o.IdleTimeout {
+		errs = append(errs, fmt.Errorf("touchInterval must be between 0 and idleTimeout"))
+	}
+	return errs
+}
@@ -0,0 +1,61 @@
+package options
+
+import (
+	"fmt"
+	"time"
+)
+
+// ThrottleLimit sets when failed logins of one scope get delayed and locked out, 0 disables
+type ThrottleLimit struct {
+	DelayAfter int `json:"delayAfter" mapstructure:"delayAfter"` // Failures before progressive delays
+	LockAfter  int `json:"lockAfter" mapstructure:"lockAfter"`   // Failures before a lockout
+}
+
+// LoginThrottleOptions contains brute-force protection configuration.
+// Failures are counted per account, per IP and per account+IP pair within Window.
+// Keep the account limits loose: an attacker can lock out any account they know.
+type LoginThrottleOptions struct {
+	Account            ThrottleLimit `json:"account" mapstructure:"account"`
+	IP                 ThrottleLimit `json:"ip" mapstructure:"ip"`
+	Pair               ThrottleLimit `json:"pair" mapstructure:"pair"`
+	Window             time.Duration `json:"window" mapstructure:"window"`
+	BaseDelay          time.Duration `json:"baseDelay" mapstructure:"baseDelay"` // Doubles with each further failure
+	MaxDelay           time.Duration `json:"maxDelay" mapstructure:"maxDelay"`
+	LockoutDuration    time.Duration `json:"lockoutDuration" mapstructure:"lockoutDuration"` // Doubles with each further lockout
+	MaxLockoutDuration time.Duration `json:"maxLockoutDuration" mapstructure:"maxLockoutDuration"`
+}
+
+// NewLoginThrottleOptions create a `zero` value instance.
+func NewLoginThrottleOptions() *LoginThrottleOptions {
+	return &LoginThrottleOptions{
+		Account:            ThrottleLimit{DelayAfter: 5, LockAfter: 20},
+		IP:                 ThrottleLimit{DelayAfter: 20, LockAfter: 100},
+		Pair:               ThrottleLimit{DelayAfter: 3, LockAfter: 10},
+		Window:             15 * time.Minute,
+		BaseDelay:          1 * time.Second,
+		MaxDelay:           30 * time.Second,
+		LockoutDuration:    15 * time.Minute,
+		MaxLockoutDuration: 24 * time.Hour,
+	}
+}
+
+// Validate verifies flags passed to LoginThrottleOptions.
+func (o *LoginThrottleOptions) Validate() []error {
+	errs := []error{}
+
+	for name, l := range map[string]ThrottleLimit{"account": o.Account, "ip": o.IP, "pair": o.Pair} {
+		if l.DelayAfter < 0 || l.LockAfter < 0 {
+			errs = append(errs, fmt.Errorf("%s limits cannot be negative", name))
+		}
+	}
+	if o.Window <= 0 {
+		errs = append(errs, fmt.Errorf("window must be greater than 0"))
+	}
+	if o.BaseDelay <= 0 || o.MaxDelay < o.BaseDelay {
+		errs = append(errs, fmt.Errorf("baseDelay must be greater than 0 and not exceed maxDelay"))
+	}
+	if o.LockoutDuration <= 0 || o.MaxLockoutDuration < o.LockoutDuration {
+		errs = append(errs, fmt.Errorf("lockoutDuration must be greater than 0 and not exceed maxLockoutDuration"))
+	}
+	return errs
+}
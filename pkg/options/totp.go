@@ -0,0 +1,74 @@
+package options
+
+import "fmt"
+
+// TOTPOptions contains TOTP (RFC 6238) configuration.
+// Most authenticator apps only support the defaults: 6 digits, 30 seconds, SHA1.
+type TOTPOptions struct {
+	Issuer     string `json:"issuer" mapstructure:"issuer"`
+	Digits     int    `json:"digits" mapstructure:"digits"`         // 6 or 8
+	Period     uint   `json:"period" mapstructure:"period"`         // Seconds
+	Algorithm  string `json:"algorithm" mapstructure:"algorithm"`   // SHA1, SHA256 or SHA512
+	Skew       uint   `json:"skew" mapstructure:"skew"`             // Periods accepted before and after the current one
+	SecretSize uint   `json:"secretSize" mapstructure:"secretSize"` // Bytes
+}
+
+// NewTOTPOptions create a `zero` value instance.
+func NewTOTPOptions() *TOTPOptions {
+	return &TOTPOptions{
+		Issuer:     "Nuwa IAM",
+		Digits:     6,
+		Period:     30,
+		Algorithm:  "SHA1",
+		Skew:       1,
+		SecretSize: 20,
+	}
+}
+
+// Complete sets default values for TOTPOptions.
+// A zero Skew is kept: it only accepts the current period.
+func (o *TOTPOptions) Complete() {
+	defaults := NewTOTPOptions()
+	if o.Issuer == "" {
+		o.Issuer = defaults.Issuer
+	}
+	if o.Digits == 0 {
+		o.Digits = defaults.Digits
+	}
+	if o.Period == 0 {
+		o.Period = defaults.Period
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = defaults.Algorithm
+	}
+	if o.SecretSize == 0 {
+		o.SecretSize = defaults.SecretSize
+	}
+}
+
+// Validate verifies flags passed to TOTPOptions.
+func (o *TOTPOptions) Validate() []error {
+	errs := []error{}
+
+	if o.Issuer == "" {
+		errs = append(errs, fmt.Errorf("issuer cannot be empty"))
+	}
+	if o.Digits != 6 && o.Digits != 8 {
+		errs = append(errs, fmt.Errorf("digits must be 6 or 8"))
+	}
+	if o.Period == 0 {
+		errs = append(errs, fmt.Errorf("period must be greater than 0"))
+	}
+	switch o.Algorithm {
+	case "SHA1", "SHA256", "SHA512":
+	default:
+		errs = append(errs, fmt.Errorf("algorithm must be SHA1, SHA256 or SHA512"))
+	}
+	if o.Skew > 5 {
+		errs = append(errs, fmt.Errorf("skew must not exceed 5 periods"))
+	}
+	if o.SecretSize < 16 {
+		errs = append(errs, fmt.Errorf("secretSize must be at least 16 bytes"))
+	}
+	return errs
+}
@@ -0,0 +1,46 @@
+package options
+
+import (
+	"fmt"
+	"time"
+)
+
+// VerificationCodeOptions contains configuration of the one-time codes sent by e-mail.
+// The resend cooldown is AuthOptions.SendCodeRateLimit.
+type VerificationCodeOptions struct {
+	Length      int           `json:"length" mapstructure:"length"` // Digits
+	TTL         time.Duration `json:"ttl" mapstructure:"ttl"`
+	MaxAttempts int           `json:"maxAttempts" mapstructure:"maxAttempts"` // Wrong codes before the code is discarded
+	// TestMode makes every code TestCode, for automated tests and local development.
+	// Never enable it in production.
+	TestMode bool   `json:"testMode" mapstructure:"testMode"`
+	TestCode string `json:"testCode" mapstructure:"testCode"`
+}
+
+// NewVerificationCodeOptions create a `zero` value instance.
+func NewVerificationCodeOptions() *VerificationCodeOptions {
+	return &VerificationCodeOptions{
+		Length:      6,
+		TTL:         10 * time.Minute,
+		MaxAttempts: 5,
+	}
+}
+
+// Validate verifies flags passed to VerificationCodeOptions.
+func (o *VerificationCodeOptions) Validate() []error {
+	errs := []error{}
+
+	if o.Length < 6 || o.Length > 10 {
+		errs = append(errs, fmt.Errorf("length must be between 6 and 10"))
+	}
+	if o.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("ttl must be greater than 0"))
+	}
+	if o.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("maxAttempts must be greater than 0"))
+	}
+	if o.TestMode && len(o.TestCode) != o.Length {
+		errs = append(errs, fmt.Errorf("testCode must be %d characters when testMode is enabled", o.Length))
+	}
+	return errs
+}
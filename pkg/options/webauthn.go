@@ -0,0 +1,60 @@
+package options
+
+import (
+	"fmt"
+	"time"
+)
+
+// WebAuthnOptions contains WebAuthn (passkey) relying party configuration
+type WebAuthnOptions struct {
+	RPID    string   `json:"rpID" mapstructure:"rpID"`       // Registrable domain, e.g. example.com
+	RPName  string   `json:"rpName" mapstructure:"rpName"`   // Shown by the authenticator
+	Origins []string `json:"origins" mapstructure:"origins"` // Allowed origins, e.g. https://login.example.com
+
+	Timeout time.Duration `json:"timeout" mapstructure:"timeout"` // Ceremony timeout, also the challenge TTL
+
+	// UserVerification is required, preferred or discouraged. With required,
+	// responses without the UV flag are rejected.
+	UserVerification string `json:"userVerification" mapstructure:"userVerification"`
+	// Attestation is the conveyance preference: none or direct (for packed attestation)
+	Attestation string `json:"attestation" mapstructure:"attestation"`
+	// ResidentKey is required, preferred or discouraged; required creates passkeys
+	ResidentKey string `json:"residentKey" mapstructure:"residentKey"`
+}
+
+// NewWebAuthnOptions create a `zero` value instance.
+func NewWebAuthnOptions() *WebAuthnOptions {
+	return &WebAuthnOptions{
+		RPID:             "localhost",
+		RPName:           "Nuwa IAM",
+		Origins:          []string{"http://localhost:8080"},
+		Timeout:          5 * time.Minute,
+		UserVerification: "preferred",
+		Attestation:      "none",
+		ResidentKey:      "preferred",
+	}
+}
+
+// Validate verifies flags passed to WebAuthnOptions.
+func (o *WebAuthnOptions) Validate() []error {
+	errs := []error{}
+
+	if o.RPID == "" {
+		errs = append(errs, fmt.Errorf("rpID cannot be empty"))
+	}
+	if len(o.Origins) == 0 {
+		errs = append(errs, fmt.Errorf("origins cannot be empty"))
+	}
+	if o.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("timeout must be greater than 0"))
+	}
+	for name, value := range map[string]string{"userVerification": o.UserVerification, "residentKey": o.ResidentKey} {
+		if value != "required" && value != "preferred" && value != "discouraged" {
+			errs = append(errs, fmt.Errorf("%s must be required, preferred or discouraged", name))
+		}
+	}
+	if o.Attestation != "none" && o.Attestation != "direct" {
+		errs = append(errs, fmt.Errorf("attestation must be none or direct"))
+	}
+	return errs
+}
@@ -3,8 +3,11 @@ package response
 import (
 	"net/http"
 
+	"github.com/arrow2012/nuwa-kit/pkg/auth"
 	"github.com/arrow2012/nuwa-kit/pkg/errors"
+	"github.com/arrow2012/nuwa-kit/pkg/log"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // Response standard structure
@@ -37,7 +40,14 @@ func Success(c *gin.Context, data interface{}) {
 	})
 }
 
-// Error sends an error response
+// Principal returns the authenticated caller of the request (set by the auth middleware),
+// e.g. to build "me" responses or to filter data by tenant
+func Principal(c *gin.Context) (*auth.Principal, bool) {
+	return auth.PrincipalFromContext(c.Request.Context())
+}
+
+// Error sends an error response.
+// Errors without a code are answered as internal errors and logged with the principal.
 func Error(c *gin.Context, err error) {
 	rid := c.GetString(ContextKeyRequestID)
 
@@ -50,12 +60,13 @@ func Error(c *gin.Context, err error) {
 		// For security, maybe hide internal details in production
 		// For now, let's wrap it as Internal Error
 		apiErr = errors.ErrInternalServer
-		// Optional: Log the real error here if not already logged
+		log.C(c.Request.Context()).Error("internal error", zap.Error(err), zap.String("path", c.FullPath()))
 	}
 
 	c.JSON(apiErr.HTTPStatus(), Response{
 		Code:      apiErr.BusinessCode(),
 		Message:   apiErr.Message(),
+		Data:      errors.Details(apiErr),
 		RequestID: rid,
 	})
 }